@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// severities are the content advisory levels, from least to most severe
+var severities = []string{"none", "mild", "moderate", "severe"}
+
+// Advisory describes why and how strongly a song's content may be unsuitable
+type Advisory struct {
+	Language string   `bson:"language,omitempty" json:"language,omitempty" description:"a description of the language used in the song"`
+	Themes   []string `bson:"themes,omitempty" json:"themes,omitempty" description:"the mature themes in the song"`
+	Severity int      `bson:"severity" json:"severity" schema:"required" description:"the advisory level from 0 (none) to 3 (severe)"`
+}
+
+// parseSeverity returns the level for a severity name
+func parseSeverity(s string) (int, bool) {
+	for i, sv := range severities {
+		if strings.EqualFold(strings.TrimSpace(s), sv) {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+func runAdvisory(args []string) int {
+	fs := flag.NewFlagSet("advisory", flag.ExitOnError)
+	ids := fs.String("ids", "", "comma separated song `ids` to update")
+	filter := fs.String("filter", "", "MongoDB query `filter` (extended JSON) selecting songs to update")
+	q := fs.String("q", "", "`query` selecting songs to update, e.g. artist:\"queen\" year:1975..1985 -explicit")
+	sev := fs.String("severity", "", "the advisory `level` ("+strings.Join(severities, ", ")+")")
+	lang := fs.String("language", "", "a `description` of the language used (e.g. crude, strong)")
+	thms := fs.String("themes", "", "comma separated `themes` (e.g. drugs,violence)")
+	clr := fs.Bool("clear", false, "remove the advisory from the selected songs")
+	fs.Parse(args)
+
+	qry, err := songsFilter(*ids, *filter, *q)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fs.Usage()
+		return exitConfig
+	}
+
+	upd := bson.M{"$unset": bson.M{"advisory": ""}}
+	if !*clr {
+		lvl, ok := parseSeverity(*sev)
+		if !ok {
+			fmt.Printf("Error: severity must be one of %s\n", strings.Join(severities, ", "))
+			fs.Usage()
+			return exitConfig
+		}
+
+		upd = bson.M{"$set": bson.M{"advisory": Advisory{
+			Language: strings.TrimSpace(*lang),
+			Themes:   splitList(*thms),
+			Severity: lvl,
+		}}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	res, err := c.Database(karaokeDB).Collection(songsCollection).UpdateMany(ctx, qry, upd)
+	if err != nil {
+		fmt.Printf("Error updating advisories: %v", err)
+		panic(err)
+	}
+
+	fmt.Printf("Advisories updated: %d songs matched and %d songs modified\n", res.MatchedCount, res.ModifiedCount)
+
+	return exitOK
+}
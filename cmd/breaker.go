@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// breakerCooldown is how long a tripped breaker waits before it lets
+	// one call through to test the provider, doubling up to
+	// breakerMaxCooldown while the provider keeps failing
+	breakerCooldown    = time.Minute
+	breakerMaxCooldown = 10 * time.Minute
+	// breakerThreshold is the number of consecutive failures that trip a
+	// breaker
+	breakerThreshold = 5
+)
+
+// errRateLimited marks a provider response asking for fewer requests, which
+// trips a breaker at once rather than retrying into a ban
+var errRateLimited = errors.New("rate limited")
+
+// breaker stops calling an external provider after repeated failures so a
+// degraded provider is waited out instead of retried
+type breaker struct {
+	name     string
+	cooldown time.Duration
+	failures int
+	openedAt time.Time
+	// exhausted is set once a test call fails at the longest cooldown, after
+	// which the remaining calls are skipped
+	exhausted bool
+	// skipped counts the calls skipped once exhausted, trips the times it
+	// opened
+	skipped int
+	trips   int
+}
+
+// breakerState is the state of a breaker at the end of a run, reported in
+// the enrichment summary and metrics
+type breakerState struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Trips    int    `json:"trips"`
+	Skipped  int    `json:"skipped"`
+}
+
+func newBreaker(name string) *breaker {
+	return &breaker{name: name, cooldown: breakerCooldown}
+}
+
+// state returns closed, open, or half-open when the cooldown has passed and
+// the next call tests the provider
+func (b *breaker) state() string {
+	switch {
+	case b.openedAt.IsZero():
+		return "closed"
+	case !b.exhausted && time.Since(b.openedAt) >= b.cooldown:
+		return "half-open"
+	default:
+		return "open"
+	}
+}
+
+func (b *breaker) String() string {
+	if st := b.state(); st != "open" {
+		return fmt.Sprintf("%s breaker %s", b.name, st)
+	}
+
+	return fmt.Sprintf("%s breaker open (tripped %d times, skipped %d calls)", b.name, b.trips, b.skipped)
+}
+
+// report returns the state of the breaker for the enrichment summary
+func (b *breaker) report() breakerState {
+	return breakerState{Provider: b.name, State: b.state(), Trips: b.trips, Skipped: b.skipped}
+}
+
+// wait reports whether a call may be made, waiting out the cooldown while
+// the breaker is open so the next call tests the provider; once exhausted
+// every call is skipped
+func (b *breaker) wait(ctx context.Context) (bool, error) {
+	if b.exhausted {
+		b.skipped++
+		return false, nil
+	}
+
+	if b.openedAt.IsZero() {
+		return true, nil
+	}
+
+	if d := b.cooldown - time.Since(b.openedAt); d > 0 {
+		if err := sleep(ctx, d); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// success closes the breaker
+func (b *breaker) success() {
+	if !b.openedAt.IsZero() {
+		fmt.Printf("Circuit breaker for %s closed\n", b.name)
+	}
+
+	b.failures, b.openedAt, b.cooldown = 0, time.Time{}, breakerCooldown
+}
+
+// failure counts a failed call, tripping the breaker after too many in a
+// row, on a failed test call, or at once when rate limited
+func (b *breaker) failure(err error) {
+	b.failures++
+
+	half := !b.openedAt.IsZero()
+	if !half && b.failures < breakerThreshold && !errors.Is(err, errRateLimited) {
+		return
+	}
+
+	b.openedAt = time.Now()
+	b.trips++
+
+	// a provider still failing after the longest cooldown is given up on
+	if half && b.cooldown == breakerMaxCooldown {
+		b.exhausted = true
+		fmt.Printf("Circuit breaker for %s opened (%v), skipping the remaining calls\n", b.name, err)
+		return
+	}
+
+	if half {
+		b.cooldown *= 2
+		if b.cooldown > breakerMaxCooldown {
+			b.cooldown = breakerMaxCooldown
+		}
+	}
+
+	fmt.Printf("Circuit breaker for %s opened (%v), waiting %s before testing it\n", b.name, err, b.cooldown)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBreakerTrips(t *testing.T) {
+	brk := newBreaker("test provider")
+	ctx := context.Background()
+
+	for i := 0; i < breakerThreshold-1; i++ {
+		brk.failure(errors.New("bad gateway"))
+	}
+	if st := brk.state(); st != "closed" {
+		t.Fatalf("state after %d failures = %s, want closed", breakerThreshold-1, st)
+	}
+
+	brk.failure(errors.New("bad gateway"))
+	if st := brk.state(); st != "open" || brk.trips != 1 {
+		t.Fatalf("state after %d failures = %s (%d trips), want open (1 trip)", breakerThreshold, st, brk.trips)
+	}
+
+	// an open breaker waits out the cooldown and then lets a test call through
+	brk.cooldown = 20 * time.Millisecond
+	st := time.Now()
+	if ok, err := brk.wait(ctx); !ok || err != nil {
+		t.Fatalf("wait = %t, %v, want a test call", ok, err)
+	}
+
+	if d := time.Since(st); d < brk.cooldown {
+		t.Errorf("wait returned after %s, want the %s cooldown", d, brk.cooldown)
+	}
+
+	if st := brk.state(); st != "half-open" {
+		t.Errorf("state after the cooldown = %s, want half-open", st)
+	}
+
+	// a failed test call opens it again for twice as long
+	brk.failure(errors.New("bad gateway"))
+	if brk.cooldown != 40*time.Millisecond || brk.trips != 2 {
+		t.Errorf("cooldown = %s (%d trips), want 40ms (2 trips)", brk.cooldown, brk.trips)
+	}
+
+	brk.success()
+	if st := brk.state(); st != "closed" || brk.cooldown != breakerCooldown {
+		t.Errorf("state after a success = %s (cooldown %s), want closed (%s)", st, brk.cooldown, breakerCooldown)
+	}
+}
+
+func TestBreakerRateLimited(t *testing.T) {
+	brk := newBreaker("test provider")
+	brk.failure(fmt.Errorf("%w by test provider: 429 Too Many Requests", errRateLimited))
+
+	if st := brk.state(); st != "open" {
+		t.Errorf("state after a rate limited call = %s, want open", st)
+	}
+}
+
+func TestBreakerExhausted(t *testing.T) {
+	brk := newBreaker("test provider")
+
+	// a test call failing at the longest cooldown gives up on the provider
+	brk.cooldown, brk.openedAt = breakerMaxCooldown, time.Now().Add(-breakerMaxCooldown)
+	brk.failure(errors.New("bad gateway"))
+
+	for i := 0; i < 3; i++ {
+		if ok, err := brk.wait(context.Background()); ok || err != nil {
+			t.Fatalf("wait = %t, %v, want the call skipped", ok, err)
+		}
+	}
+
+	rep := brk.report()
+	if rep != (breakerState{Provider: "test provider", State: "open", Trips: 1, Skipped: 3}) {
+		t.Errorf("report = %+v, want open with 1 trip and 3 skipped calls", rep)
+	}
+
+	if s := brk.String(); !strings.Contains(s, "skipped 3 calls") {
+		t.Errorf("String = %s, want the skipped calls", s)
+	}
+}
+
+func TestBreakerWaitCanceled(t *testing.T) {
+	brk := newBreaker("test provider")
+	brk.failure(errRateLimited)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := brk.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait when canceled = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestEnrichmentMetrics(t *testing.T) {
+	s := enrichmentSummary{Enriched: 40, Failed: 5, Skipped: 12, Breaker: breakerState{State: "half-open", Trips: 2}, DurationMs: 1500}
+	m := enrichmentMetrics(s, time.Unix(1700000000, 0))
+
+	for _, want := range []string{
+		"karaoke_enrichment_duration_seconds 1.5\n",
+		`karaoke_enrichment_songs{result="skipped"} 12` + "\n",
+		`karaoke_enrichment_breaker_state{state="closed"} 0` + "\n",
+		`karaoke_enrichment_breaker_state{state="half-open"} 1` + "\n",
+		`karaoke_enrichment_breaker_state{state="open"} 0` + "\n",
+		"karaoke_enrichment_breaker_trips 2\n",
+		"karaoke_enrichment_last_run_timestamp_seconds 1700000000\n",
+	} {
+		if !strings.Contains(m, want) {
+			t.Errorf("metrics missing %q:\n%s", want, m)
+		}
+	}
+}
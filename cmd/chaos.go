@@ -0,0 +1,102 @@
+//go:build chaos
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// failure injection, only compiled into binaries built with -tags chaos so
+// the retry, backoff, and circuit breaker paths can be exercised before a
+// show; rates are percentages of calls
+var (
+	chaosHTTPFailureRate = envInt("KARAOKE_CHAOS_HTTP_FAILURE_RATE", 0)
+	chaosHTTPStatus      = envInt("KARAOKE_CHAOS_HTTP_STATUS", http.StatusServiceUnavailable)
+	chaosMongoLatency    = time.Duration(envInt("KARAOKE_CHAOS_MONGO_LATENCY", 0)) * time.Millisecond
+	chaosMongoRate       = envInt("KARAOKE_CHAOS_MONGO_RATE", 100)
+)
+
+// errChaos is the error of an injected connection failure
+var errChaos = errors.New("connection failure injected by chaos testing")
+
+// chance reports whether a call is picked at the rate
+func chance(rate int) bool {
+	return rate > 0 && rand.Intn(100) < rate
+}
+
+// startChaos warns that failures will be injected, so a chaos build is
+// never mistaken for a normal one
+func startChaos() {
+	if chaosHTTPFailureRate == 0 && chaosMongoLatency == 0 {
+		return
+	}
+
+	fmt.Printf("Warning: chaos testing injects HTTP failures into %d%% of calls (status %d) and %s of latency into %d%% of MongoDB commands\n",
+		chaosHTTPFailureRate, chaosHTTPStatus, chaosMongoLatency, chaosMongoRate)
+}
+
+// chaosRoundTripper fails a share of outbound calls with an error status, or
+// a connection error when the status is 0
+type chaosRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (t chaosRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !chance(chaosHTTPFailureRate) {
+		return t.next.RoundTrip(req)
+	}
+
+	if chaosHTTPStatus == 0 {
+		return nil, errChaos
+	}
+
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", chaosHTTPStatus, http.StatusText(chaosHTTPStatus)),
+		StatusCode: chaosHTTPStatus,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       io.NopCloser(strings.NewReader(errChaos.Error())),
+		Request:    req,
+	}, nil
+}
+
+// chaosTransport wraps the transport of the shared HTTP client
+func chaosTransport(next http.RoundTripper) http.RoundTripper {
+	if chaosHTTPFailureRate == 0 {
+		return next
+	}
+
+	return chaosRoundTripper{next: next}
+}
+
+// chaosMonitor delays a share of MongoDB commands before they are sent, as
+// a slow or overloaded cluster would
+func chaosMonitor() *event.CommandMonitor {
+	if chaosMongoLatency == 0 {
+		return nil
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, _ *event.CommandStartedEvent) {
+			if !chance(chaosMongoRate) {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(chaosMongoLatency):
+			}
+		},
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !chaos
+
+package main
+
+import (
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// startChaos does nothing without the chaos build tag
+func startChaos() {}
+
+// chaosTransport leaves the transport as is without the chaos build tag
+func chaosTransport(next http.RoundTripper) http.RoundTripper {
+	return next
+}
+
+// chaosMonitor monitors nothing without the chaos build tag
+func chaosMonitor() *event.CommandMonitor {
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+var (
+	tLanguage = reflect.TypeOf(Language(""))
+	tSongID   = reflect.TypeOf(SongID(""))
+	tStyle    = reflect.TypeOf(Style(""))
+	// songsRegistry encodes and decodes the catalog's domain types; it is
+	// registered on every client so they are stored consistently
+	songsRegistry = newSongsRegistry()
+)
+
+// Language is a language a song is sung in, as named by the provider
+type Language string
+
+// Style is a musical style of a song, as named by the provider
+type Style string
+
+// parseLanguages splits a comma separated list of languages
+func parseLanguages(s string) []Language {
+	lngs := []Language{}
+	for _, v := range splitList(s) {
+		lngs = append(lngs, Language(v))
+	}
+
+	return lngs
+}
+
+// parseStyles splits a comma separated list of styles
+func parseStyles(s string) []Style {
+	stls := []Style{}
+	for _, v := range splitList(s) {
+		stls = append(stls, Style(v))
+	}
+
+	return stls
+}
+
+// joinValues joins string based values with a separator
+func joinValues[T ~string](vs []T, sep string) string {
+	ss := make([]string, len(vs))
+	for i, v := range vs {
+		ss[i] = string(v)
+	}
+
+	return strings.Join(ss, sep)
+}
+
+func newSongsRegistry() *bsoncodec.Registry {
+	r := bson.NewRegistry()
+	r.RegisterTypeEncoder(tSongID, bsoncodec.ValueEncoderFunc(encodeSongID))
+	r.RegisterTypeDecoder(tSongID, bsoncodec.ValueDecoderFunc(decodeSongID))
+
+	for _, t := range []reflect.Type{tLanguage, tStyle} {
+		r.RegisterTypeEncoder(t, bsoncodec.ValueEncoderFunc(encodeName))
+		r.RegisterTypeDecoder(t, bsoncodec.ValueDecoderFunc(decodeName))
+	}
+
+	return r
+}
+
+// encodeSongID stores numeric IDs as int32 (or int64 when too large) so
+// existing numeric IDs keep matching, and other IDs as strings
+func encodeSongID(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	id := SongID(val.String())
+	if id == "" {
+		return fmt.Errorf("song id is empty")
+	}
+
+	if n, ok := id.number(); ok {
+		if n >= -1<<31 && n < 1<<31 {
+			return vw.WriteInt32(int32(n))
+		}
+
+		return vw.WriteInt64(n)
+	}
+
+	return vw.WriteString(string(id))
+}
+
+func decodeSongID(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	var id string
+	switch vr.Type() {
+	case bsontype.Int32:
+		n, err := vr.ReadInt32()
+		if err != nil {
+			return err
+		}
+		id = strconv.FormatInt(int64(n), 10)
+	case bsontype.Int64:
+		n, err := vr.ReadInt64()
+		if err != nil {
+			return err
+		}
+		id = strconv.FormatInt(n, 10)
+	case bsontype.Double:
+		f, err := vr.ReadDouble()
+		if err != nil {
+			return err
+		}
+		id = strconv.FormatFloat(f, 'f', -1, 64)
+	case bsontype.String:
+		s, err := vr.ReadString()
+		if err != nil {
+			return err
+		}
+		id = s
+	default:
+		return fmt.Errorf("unable to decode song id from %s", vr.Type())
+	}
+
+	val.SetString(id)
+	return nil
+}
+
+// encodeName stores a provider name (language or style) without surrounding
+// whitespace, rejecting empty names
+func encodeName(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	s := strings.TrimSpace(val.String())
+	if s == "" {
+		return fmt.Errorf("empty %s", strings.ToLower(val.Type().Name()))
+	}
+
+	return vw.WriteString(s)
+}
+
+func decodeName(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if vr.Type() != bsontype.String {
+		return fmt.Errorf("unable to decode %s from %s", strings.ToLower(val.Type().Name()), vr.Type())
+	}
+
+	s, err := vr.ReadString()
+	if err != nil {
+		return err
+	}
+
+	val.SetString(strings.TrimSpace(s))
+	return nil
+}
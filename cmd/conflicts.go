@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// conflict policies for a field edited locally since the last import: the
+// provider's value replaces the edit, the edit is kept, or list values are
+// merged
+const (
+	policyKeepMine   = "keep-mine"
+	policyMerge      = "merge"
+	policyTakeTheirs = "take-theirs"
+)
+
+var (
+	// conflictClasses name groups of imported fields a policy can be set for
+	// at once; regions and mood are derived by the import and always replaced
+	conflictClasses = map[string][]string{
+		"details": {"year", "duo", "explicit", "dateAdded"},
+		"lists":   {"styles", "languages"},
+		"text":    {"title", "artist"},
+	}
+	// conflictPolicies are the policies by field, take-theirs when unset
+	conflictPolicies = map[string]string{}
+	// protectedFields are never overwritten by imports, whatever the
+	// conflict policy
+	protectedFields = map[string]bool{}
+)
+
+// fieldHash returns a short hash of a field value, normalized so a stored
+// value hashes the same as the imported value it was written from
+func fieldHash(v reflect.Value) string {
+	var s string
+	switch {
+	case v.Kind() == reflect.Slice:
+		s = strings.Join(listValues(v), "\x1f")
+	case v.Type() == reflect.TypeOf(time.Time{}):
+		s = v.Interface().(time.Time).UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano)
+	default:
+		s = fmt.Sprint(v.Interface())
+	}
+
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:8])
+}
+
+// fieldHashes returns the hash of each imported field of a song, so later
+// imports can tell the fields edited locally apart
+func fieldHashes(sng Song) map[string]string {
+	hs := map[string]string{}
+	v := reflect.ValueOf(sng)
+	for i := 0; i < v.NumField(); i++ {
+		if name, _ := bsonField(v.Type().Field(i)); name != "" {
+			hs[name] = fieldHash(v.Field(i))
+		}
+	}
+
+	return hs
+}
+
+// setConflictPolicy sets the policy of a field or class of fields from
+// field=policy
+func setConflictPolicy(v string) error {
+	k, pol, ok := strings.Cut(v, "=")
+	if !ok {
+		return fmt.Errorf("expected field=policy")
+	}
+
+	if pol != policyKeepMine && pol != policyMerge && pol != policyTakeTheirs {
+		return fmt.Errorf("unknown policy (%s), expected %s, %s, or %s", pol, policyKeepMine, policyTakeTheirs, policyMerge)
+	}
+
+	flds, ok := conflictClasses[k]
+	if !ok {
+		flds = []string{k}
+	}
+
+	for _, f := range flds {
+		if !conflictField(f) {
+			return fmt.Errorf("unknown field (%s), expected one of %s", f, strings.Join(conflictFields(), ", "))
+		}
+
+		if pol == policyMerge && !listField(f) {
+			return fmt.Errorf("%s is not a list, only lists can be merged", f)
+		}
+
+		conflictPolicies[f] = pol
+	}
+
+	return nil
+}
+
+// conflictFields returns the fields conflict policies can be set for
+func conflictFields() []string {
+	var flds []string
+	for k, fs := range conflictClasses {
+		flds = append(flds, k)
+		flds = append(flds, fs...)
+	}
+	sort.Strings(flds)
+
+	return flds
+}
+
+// conflictField reports whether a policy can be set for the field
+func conflictField(f string) bool {
+	for _, fs := range conflictClasses {
+		for _, cf := range fs {
+			if cf == f {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// listField reports whether the imported field is a list
+func listField(f string) bool {
+	t := reflect.TypeOf(Song{})
+	for i := 0; i < t.NumField(); i++ {
+		if name, _ := bsonField(t.Field(i)); name == f {
+			return t.Field(i).Type.Kind() == reflect.Slice
+		}
+	}
+
+	return false
+}
+
+// mergeList returns the stored values followed by the imported values not
+// already stored
+func mergeList(old reflect.Value, sng reflect.Value) reflect.Value {
+	mrg := reflect.AppendSlice(reflect.MakeSlice(old.Type(), 0, old.Len()+sng.Len()), old)
+	has := map[string]bool{}
+	for _, v := range listValues(old) {
+		has[v] = true
+	}
+
+	for i := 0; i < sng.Len(); i++ {
+		if !has[sng.Index(i).String()] {
+			mrg = reflect.Append(mrg, sng.Index(i))
+		}
+	}
+
+	return mrg
+}
+
+// resolveConflicts applies the conflict policies to the fields of a stored
+// song edited since the last import, returning the song to write and the
+// fields whose local edits were kept or merged; songs imported before field
+// hashes were recorded can not be told apart from edits and take theirs
+func resolveConflicts(sng Song, old importedSong) (Song, []string) {
+	if len(conflictPolicies) == 0 || old.FieldHashes == nil {
+		return sng, nil
+	}
+
+	res := sng
+	rv, ov := reflect.ValueOf(&res).Elem(), reflect.ValueOf(old.Song)
+	var kept []string
+	for i := 0; i < rv.NumField(); i++ {
+		name, _ := bsonField(rv.Type().Field(i))
+		pol := conflictPolicies[name]
+		if pol == "" || pol == policyTakeTheirs {
+			continue
+		}
+
+		// the stored value is still what the provider last supplied
+		if h, ok := old.FieldHashes[name]; !ok || fieldHash(ov.Field(i)) == h {
+			continue
+		}
+
+		if pol == policyMerge {
+			rv.Field(i).Set(mergeList(ov.Field(i), rv.Field(i)))
+		} else {
+			rv.Field(i).Set(ov.Field(i))
+		}
+		kept = append(kept, name)
+
+		// the mood follows the styles written
+		if name == "styles" {
+			res.Mood = classifyMood(res)
+		}
+	}
+
+	return res, kept
+}
+
+// protectFields adds comma separated fields to the protected fields, which
+// imports write when inserting a song but never overwrite; the mood is
+// protected along with the styles it is classified from
+func protectFields(v string) error {
+	for _, f := range strings.Split(v, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+
+		if f == "id" || (!importedField(f) && !localField(f)) {
+			return fmt.Errorf("unknown field (%s)", f)
+		}
+
+		protectedFields[f] = true
+		if f == "styles" {
+			protectedFields["mood"] = true
+		}
+	}
+
+	return nil
+}
+
+// importedField reports whether the field is written by imports
+func importedField(f string) bool {
+	_, ok := fieldHashes(Song{})[f]
+	return ok
+}
+
+// localField reports whether the field is maintained outside of imports
+func localField(f string) bool {
+	for _, lf := range localFields {
+		if lf == f {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keepProtected returns the song with the stored values of its protected
+// fields
+func keepProtected(sng Song, old Song) Song {
+	if len(protectedFields) == 0 {
+		return sng
+	}
+
+	rv, ov := reflect.ValueOf(&sng).Elem(), reflect.ValueOf(old)
+	for i := 0; i < rv.NumField(); i++ {
+		if name, _ := bsonField(rv.Type().Field(i)); protectedFields[name] {
+			rv.Field(i).Set(ov.Field(i))
+		}
+	}
+
+	return sng
+}
+
+// songUpdate returns the update writing an imported song, setting protected
+// fields only when the song is inserted
+func songUpdate(is importedSong) (bson.M, error) {
+	if len(protectedFields) == 0 {
+		return bson.M{"$set": is}, nil
+	}
+
+	// encoded with the catalog's codecs so IDs keep their stored types
+	b, err := bson.MarshalWithRegistry(songsRegistry, is)
+	if err != nil {
+		return nil, err
+	}
+
+	var set bson.M
+	if err := bson.UnmarshalWithRegistry(songsRegistry, b, &set); err != nil {
+		return nil, err
+	}
+
+	ins := bson.M{}
+	for f := range protectedFields {
+		if v, ok := set[f]; ok {
+			ins[f] = v
+			delete(set, f)
+		}
+	}
+
+	return bson.M{"$set": set, "$setOnInsert": ins}, nil
+}
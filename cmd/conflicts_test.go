@@ -0,0 +1,214 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// withPolicies sets the conflict policies and protected fields for a test,
+// restoring the defaults when it ends
+func withPolicies(t *testing.T, pols map[string]string, prot ...string) {
+	t.Helper()
+
+	conflictPolicies, protectedFields = map[string]string{}, map[string]bool{}
+	t.Cleanup(func() {
+		conflictPolicies, protectedFields = map[string]string{}, map[string]bool{}
+	})
+
+	for f, pol := range pols {
+		if err := setConflictPolicy(f + "=" + pol); err != nil {
+			t.Fatalf("setConflictPolicy(%s=%s): %v", f, pol, err)
+		}
+	}
+
+	for _, f := range prot {
+		if err := protectFields(f); err != nil {
+			t.Fatalf("protectFields(%s): %v", f, err)
+		}
+	}
+}
+
+func TestSongUpdateIDEncoding(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		id   SongID
+		want any
+	}{
+		{"numeric", "49375", int32(49375)},
+		{"large", "9876543210", int64(9876543210)},
+		{"alphanumeric", "kf-49375", "kf-49375"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withPolicies(t, nil, "title")
+
+			upd, err := songUpdate(importedSong{Song: Song{ID: tc.id, Title: "Bohemian Rhapsody", Artist: "Queen"}})
+			if err != nil {
+				t.Fatalf("songUpdate: %v", err)
+			}
+
+			set := upd["$set"].(bson.M)
+			if got := set["id"]; got != tc.want {
+				t.Errorf("$set.id = %#v (%T), want %#v (%T)", got, got, tc.want, tc.want)
+			}
+
+			// the filter imports write with must match the ID written
+			b, err := bson.MarshalWithRegistry(songsRegistry, bson.M{"id": tc.id})
+			if err != nil {
+				t.Fatalf("encoding filter: %v", err)
+			}
+
+			var flt bson.M
+			if err := bson.Unmarshal(b, &flt); err != nil {
+				t.Fatalf("decoding filter: %v", err)
+			}
+
+			if flt["id"] != set["id"] {
+				t.Errorf("filter id = %#v, $set.id = %#v", flt["id"], set["id"])
+			}
+
+			ins := upd["$setOnInsert"].(bson.M)
+			if _, ok := set["title"]; ok {
+				t.Errorf("$set includes protected title")
+			}
+
+			if ins["title"] != "Bohemian Rhapsody" {
+				t.Errorf("$setOnInsert.title = %#v, want %q", ins["title"], "Bohemian Rhapsody")
+			}
+		})
+	}
+}
+
+func TestSongUpdateUnprotected(t *testing.T) {
+	withPolicies(t, nil)
+
+	upd, err := songUpdate(importedSong{Song: Song{ID: "1"}})
+	if err != nil {
+		t.Fatalf("songUpdate: %v", err)
+	}
+
+	if _, ok := upd["$setOnInsert"]; ok {
+		t.Errorf("$setOnInsert set without protected fields")
+	}
+}
+
+func TestKeepProtected(t *testing.T) {
+	sng := Song{ID: "1", Title: "Imported", Artist: "Queen", Year: 1975, Styles: []Style{"Rock"}, Mood: "energetic"}
+	old := Song{ID: "1", Title: "Edited", Artist: "Queen", Year: 1976, Styles: []Style{"Ballad"}, Mood: "mellow"}
+
+	for _, tc := range []struct {
+		name string
+		prot []string
+		want Song
+	}{
+		{"none", nil, sng},
+		{"title", []string{"title"}, Song{ID: "1", Title: "Edited", Artist: "Queen", Year: 1975, Styles: []Style{"Rock"}, Mood: "energetic"}},
+		{"styles keep mood", []string{"styles"}, Song{ID: "1", Title: "Imported", Artist: "Queen", Year: 1975, Styles: []Style{"Ballad"}, Mood: "mellow"}},
+		{"several", []string{"title,year"}, Song{ID: "1", Title: "Edited", Artist: "Queen", Year: 1976, Styles: []Style{"Rock"}, Mood: "energetic"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withPolicies(t, nil, tc.prot...)
+
+			if got := keepProtected(sng, old); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("keepProtected = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProtectFieldsUnknown(t *testing.T) {
+	withPolicies(t, nil)
+
+	for _, f := range []string{"id", "nope"} {
+		if err := protectFields(f); err == nil {
+			t.Errorf("protectFields(%s) accepted", f)
+		}
+	}
+}
+
+func TestResolveConflicts(t *testing.T) {
+	// the provider last supplied the title "Original" and the style Rock
+	last := Song{ID: "1", Title: "Original", Artist: "Queen", Styles: []Style{"Rock"}}
+	sng := Song{ID: "1", Title: "Updated", Artist: "Queen", Styles: []Style{"Rock", "Pop"}}
+
+	for _, tc := range []struct {
+		name   string
+		pols   map[string]string
+		stored Song
+		hashes map[string]string
+		want   Song
+		kept   []string
+	}{
+		{
+			name:   "no policies",
+			stored: Song{ID: "1", Title: "Edited", Artist: "Queen", Styles: []Style{"Rock"}},
+			hashes: fieldHashes(last),
+			want:   sng,
+		},
+		{
+			name:   "keep mine edited",
+			pols:   map[string]string{"title": policyKeepMine},
+			stored: Song{ID: "1", Title: "Edited", Artist: "Queen", Styles: []Style{"Rock"}},
+			hashes: fieldHashes(last),
+			want:   Song{ID: "1", Title: "Edited", Artist: "Queen", Styles: []Style{"Rock", "Pop"}},
+			kept:   []string{"title"},
+		},
+		{
+			name:   "keep mine unedited",
+			pols:   map[string]string{"title": policyKeepMine},
+			stored: last,
+			hashes: fieldHashes(last),
+			want:   sng,
+		},
+		{
+			name:   "take theirs",
+			pols:   map[string]string{"text": policyTakeTheirs},
+			stored: Song{ID: "1", Title: "Edited", Artist: "Queen", Styles: []Style{"Rock"}},
+			hashes: fieldHashes(last),
+			want:   sng,
+		},
+		{
+			name:   "merge",
+			pols:   map[string]string{"styles": policyMerge},
+			stored: Song{ID: "1", Title: "Original", Artist: "Queen", Styles: []Style{"Rock", "Ballad"}},
+			hashes: fieldHashes(last),
+			want:   Song{ID: "1", Title: "Updated", Artist: "Queen", Styles: []Style{"Rock", "Ballad", "Pop"}},
+			kept:   []string{"styles"},
+		},
+		{
+			name:   "no hashes",
+			pols:   map[string]string{"title": policyKeepMine},
+			stored: Song{ID: "1", Title: "Edited", Artist: "Queen", Styles: []Style{"Rock"}},
+			want:   sng,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			withPolicies(t, tc.pols)
+
+			want := tc.want
+			if len(tc.kept) > 0 && tc.kept[0] == "styles" {
+				want.Mood = classifyMood(want)
+			}
+
+			got, kept := resolveConflicts(sng, importedSong{tc.stored, Provenance{FieldHashes: tc.hashes}})
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("resolveConflicts = %+v, want %+v", got, want)
+			}
+
+			if !reflect.DeepEqual(kept, tc.kept) {
+				t.Errorf("kept = %v, want %v", kept, tc.kept)
+			}
+		})
+	}
+}
+
+func TestSetConflictPolicyErrors(t *testing.T) {
+	withPolicies(t, nil)
+
+	for _, v := range []string{"title", "title=mine", "nope=keep-mine", "title=merge"} {
+		if err := setConflictPolicy(v); err == nil {
+			t.Errorf("setConflictPolicy(%s) accepted", v)
+		}
+	}
+}
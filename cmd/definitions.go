@@ -0,0 +1,172 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// definitionsVersion is the version of the definitions file format read
+const definitionsVersion = 1
+
+var (
+	//go:embed definitions.json
+	defaultDefinitions []byte
+	definitionsPath    = os.Getenv("KARAOKE_DEFINITIONS_FILE")
+	// songsDefinitions are the index and validator definitions in effect
+	songsDefinitions definitions
+	// validatorOverrides are merged into the generated schema of the
+	// property at each path after schemaOverrides
+	validatorOverrides map[string]bson.M
+)
+
+// definitions are the indices and validator constraints of the songs
+// collection, read from a file so they can be tuned per deployment
+type definitions struct {
+	Version   int               `bson:"version"`
+	Indexes   []indexDefinition `bson:"indexes"`
+	Validator map[string]bson.M `bson:"validator"`
+}
+
+// indexDefinition is an index of the songs collection
+type indexDefinition struct {
+	Name   string     `bson:"name,omitempty"`
+	Keys   []indexKey `bson:"keys"`
+	Unique bool       `bson:"unique,omitempty"`
+}
+
+// indexKey is a field of an index and its order (1 or -1)
+type indexKey struct {
+	Field string `bson:"field"`
+	Order int    `bson:"order"`
+}
+
+// model returns the driver index model of the definition
+func (d indexDefinition) model() mongo.IndexModel {
+	keys := make(bson.D, 0, len(d.Keys))
+	for _, k := range d.Keys {
+		keys = append(keys, primitive.E{Key: k.Field, Value: k.Order})
+	}
+
+	im := mongo.IndexModel{Keys: keys}
+	if d.Name != "" || d.Unique {
+		im.Options = options.Index()
+	}
+
+	if d.Name != "" {
+		im.Options.SetName(d.Name)
+	}
+
+	if d.Unique {
+		im.Options.SetUnique(true)
+	}
+
+	return im
+}
+
+// parseDefinitions reads and checks definitions in (extended) JSON
+func parseDefinitions(b []byte) (definitions, error) {
+	var defs definitions
+	if err := bson.UnmarshalExtJSON(b, false, &defs); err != nil {
+		return defs, err
+	}
+
+	if defs.Version != definitionsVersion {
+		return defs, fmt.Errorf("unsupported version %d (expected %d)", defs.Version, definitionsVersion)
+	}
+
+	if len(defs.Indexes) == 0 {
+		return defs, fmt.Errorf("no indexes defined")
+	}
+
+	for i, d := range defs.Indexes {
+		if len(d.Keys) == 0 {
+			return defs, fmt.Errorf("index %d has no keys", i+1)
+		}
+
+		for _, k := range d.Keys {
+			if k.Field == "" || (k.Order != 1 && k.Order != -1) {
+				return defs, fmt.Errorf("index %d has an invalid key (%s: %d), orders are 1 or -1", i+1, k.Field, k.Order)
+			}
+		}
+	}
+
+	// the validator constrains the generated schema, so it can only refer
+	// to stored fields
+	sch := documentSchema(reflect.TypeOf(songDocument{}), "")
+	for p := range defs.Validator {
+		if !schemaHasPath(sch, p) {
+			return defs, fmt.Errorf("validator refers to an unknown field (%s)", p)
+		}
+	}
+
+	return defs, nil
+}
+
+// schemaHasPath reports whether the dotted path is a property of the schema,
+// looking through arrays to the schema of their items
+func schemaHasPath(sch bson.M, path string) bool {
+	for _, name := range strings.Split(path, ".") {
+		if items, ok := sch["items"].(bson.M); ok {
+			sch = items
+		}
+
+		props, _ := sch["properties"].(bson.M)
+		if sch, _ = props[name].(bson.M); sch == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// loadDefinitions applies the definitions file named by
+// KARAOKE_DEFINITIONS_FILE, or the embedded defaults when unset
+func loadDefinitions() {
+	b, src := defaultDefinitions, "embedded"
+	if definitionsPath != "" {
+		var err error
+		if b, err = os.ReadFile(definitionsPath); err != nil {
+			fmt.Printf("Error reading definitions (%s): %v", definitionsPath, err)
+			panic(exitError{exitConfig, err})
+		}
+		src = definitionsPath
+	}
+
+	defs, err := parseDefinitions(b)
+	if err != nil {
+		fmt.Printf("Error parsing definitions (%s): %v", src, err)
+		panic(exitError{exitConfig, err})
+	}
+
+	songsDefinitions = defs
+	songsIndices = make([]mongo.IndexModel, 0, len(defs.Indexes))
+	for _, d := range defs.Indexes {
+		songsIndices = append(songsIndices, d.model())
+	}
+
+	// regenerate the schema with the validator constraints
+	validatorOverrides = defs.Validator
+	songsSchema = documentSchema(reflect.TypeOf(songDocument{}), "")
+}
+
+// printDefinitions prints the definitions in effect, ready to be copied into
+// a definitions file and tuned
+func printDefinitions() int {
+	b, err := bson.MarshalExtJSONIndent(songsDefinitions, false, false, "", "  ")
+	if err != nil {
+		fmt.Printf("Error encoding definitions: %v", err)
+		panic(err)
+	}
+
+	fmt.Println(string(b))
+
+	return exitOK
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxRunChanges bounds the songs whose changes are kept on the import run
+// record so a large provider correction stays within the document limit
+const maxRunChanges = 5000
+
+// fieldChange is a change to one field of a song; list fields report the
+// values gained and lost rather than the whole list
+type fieldChange struct {
+	Field   string   `bson:"field" json:"field"`
+	From    any      `bson:"from,omitempty" json:"from,omitempty"`
+	To      any      `bson:"to,omitempty" json:"to,omitempty"`
+	Added   []string `bson:"added,omitempty" json:"added,omitempty"`
+	Removed []string `bson:"removed,omitempty" json:"removed,omitempty"`
+}
+
+// songChanges are the fields an import changed on an existing song
+type songChanges struct {
+	ID     SongID        `bson:"id" json:"id"`
+	Title  string        `bson:"title" json:"title"`
+	Artist string        `bson:"artist" json:"artist"`
+	Fields []fieldChange `bson:"fields" json:"fields"`
+}
+
+// listValues returns the elements of a string based slice as strings
+func listValues(v reflect.Value) []string {
+	vs := make([]string, v.Len())
+	for i := range vs {
+		vs[i] = v.Index(i).String()
+	}
+
+	return vs
+}
+
+// listChanges returns the values in to that are not in from
+func listChanges(from []string, to []string) []string {
+	has := make(map[string]bool, len(from))
+	for _, v := range from {
+		has[v] = true
+	}
+
+	var chgs []string
+	for _, v := range to {
+		if !has[v] {
+			chgs = append(chgs, v)
+		}
+	}
+
+	return chgs
+}
+
+// songDiff compares the imported fields of a stored song with an imported
+// song and returns each field that changed
+func songDiff(old Song, sng Song) []fieldChange {
+	var chgs []fieldChange
+
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(sng)
+	for i := 0; i < ov.NumField(); i++ {
+		name, _ := bsonField(ov.Type().Field(i))
+		if name == "" {
+			continue
+		}
+
+		of, nf := ov.Field(i), nv.Field(i)
+		switch {
+		case of.Kind() == reflect.Slice:
+			from, to := listValues(of), listValues(nf)
+			add, rm := listChanges(from, to), listChanges(to, from)
+			if len(add)+len(rm) > 0 {
+				chgs = append(chgs, fieldChange{Field: name, Added: add, Removed: rm})
+			}
+		case of.Type() == reflect.TypeOf(time.Time{}):
+			// stored dates only keep millisecond precision
+			ot, nt := of.Interface().(time.Time), nf.Interface().(time.Time)
+			if !ot.Equal(nt.Truncate(time.Millisecond)) {
+				chgs = append(chgs, fieldChange{Field: name, From: ot.UTC(), To: nt.UTC()})
+			}
+		case of.Interface() != nf.Interface():
+			chgs = append(chgs, fieldChange{Field: name, From: of.Interface(), To: nf.Interface()})
+		}
+	}
+
+	return chgs
+}
+
+// describeChanges formats field changes for the import log, e.g.
+// "year 0 → 1987, styles +Disco"
+func describeChanges(chgs []fieldChange) string {
+	ds := make([]string, 0, len(chgs))
+	for _, chg := range chgs {
+		if chg.Added != nil || chg.Removed != nil {
+			var lst []string
+			for _, v := range chg.Added {
+				lst = append(lst, "+"+v)
+			}
+			for _, v := range chg.Removed {
+				lst = append(lst, "-"+v)
+			}
+
+			ds = append(ds, chg.Field+" "+strings.Join(lst, " "))
+			continue
+		}
+
+		ds = append(ds, fmt.Sprintf("%s %v → %v", chg.Field, chg.From, chg.To))
+	}
+
+	return strings.Join(ds, ", ")
+}
+
+// existingSongs returns the songs in the live catalog with the IDs, with the
+// provenance of the import that last wrote them
+func existingSongs(ctx context.Context, c *mongo.Client, sngs []Song) map[SongID]importedSong {
+	ids := make([]SongID, 0, len(sngs))
+	for _, sng := range sngs {
+		ids = append(ids, sng.ID)
+	}
+
+	cur, err := c.Database(karaokeDB).Collection(songsCollection).Find(ctx, bson.M{"id": bson.M{"$in": ids}})
+	if err != nil {
+		fmt.Printf("Error retrieving existing songs: %v", err)
+		panic(err)
+	}
+
+	var esngs []importedSong
+	if err = cur.All(ctx, &esngs); err != nil {
+		fmt.Printf("Error reading existing songs: %v", err)
+		panic(err)
+	}
+
+	ex := make(map[SongID]importedSong, len(esngs))
+	for _, sng := range esngs {
+		ex[sng.ID] = sng
+	}
+
+	return ex
+}
+
+// recordChanges logs the changes to a song and keeps them for the import
+// run record
+func recordChanges(sng Song, chgs []fieldChange) {
+	fmt.Printf("Changed song (%s): %s\n", sng.ID, describeChanges(chgs))
+
+	if len(summary.Changes) >= maxRunChanges {
+		summary.ChangesTruncated++
+		return
+	}
+
+	summary.Changes = append(summary.Changes, songChanges{
+		ID:     sng.ID,
+		Title:  sng.Title,
+		Artist: sng.Artist,
+		Fields: chgs,
+	})
+}
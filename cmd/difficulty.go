@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	// difficulties are the singing difficulty levels, from easiest to hardest
+	difficulties = []string{"easy", "medium", "hard"}
+	// noteSteps are the semitones of each natural note above C
+	noteSteps = map[byte]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
+)
+
+// Difficulty describes how hard a song is to sing and the vocal range it
+// spans, with notes in scientific pitch notation (e.g. A2, F#4, Bb3)
+type Difficulty struct {
+	Level int    `bson:"level" json:"level" schema:"required" description:"the difficulty level from 0 (easy) to 2 (hard)"`
+	Low   string `bson:"low,omitempty" json:"low,omitempty" description:"the lowest note of the vocal range (e.g. A2)"`
+	High  string `bson:"high,omitempty" json:"high,omitempty" description:"the highest note of the vocal range (e.g. E4)"`
+}
+
+// parseLevel returns the level for a difficulty name
+func parseLevel(s string) (int, bool) {
+	for i, d := range difficulties {
+		if strings.EqualFold(strings.TrimSpace(s), d) {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// parseNote returns the MIDI number of a note in scientific pitch notation
+func parseNote(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 {
+		return 0, false
+	}
+
+	stp, ok := noteSteps[strings.ToUpper(s[:1])[0]]
+	if !ok {
+		return 0, false
+	}
+
+	// apply a sharp or flat
+	s = s[1:]
+	switch s[0] {
+	case '#':
+		stp++
+		s = s[1:]
+	case 'b':
+		stp--
+		s = s[1:]
+	}
+
+	if len(s) != 1 || s[0] < '0' || s[0] > '9' {
+		return 0, false
+	}
+
+	return (int(s[0]-'0')+1)*12 + stp, true
+}
+
+// parseRange splits a vocal range such as "A2-E4" into its lowest and
+// highest notes
+func parseRange(s string) (string, string, error) {
+	lh := strings.SplitN(s, "-", 2)
+	if len(lh) != 2 {
+		return "", "", fmt.Errorf("vocal range must be low-high (e.g. A2-E4): %s", s)
+	}
+
+	lw, hi := strings.TrimSpace(lh[0]), strings.TrimSpace(lh[1])
+	ln, ok := parseNote(lw)
+	if !ok {
+		return "", "", fmt.Errorf("invalid note (%s) in vocal range", lw)
+	}
+
+	hn, ok := parseNote(hi)
+	if !ok {
+		return "", "", fmt.Errorf("invalid note (%s) in vocal range", hi)
+	}
+
+	if ln > hn {
+		return "", "", fmt.Errorf("lowest note (%s) is above highest note (%s)", lw, hi)
+	}
+
+	return lw, hi, nil
+}
+
+func runDifficulty(args []string) int {
+	fs := flag.NewFlagSet("difficulty", flag.ExitOnError)
+	ids := fs.String("ids", "", "comma separated song `ids` to update")
+	filter := fs.String("filter", "", "MongoDB query `filter` (extended JSON) selecting songs to update")
+	q := fs.String("q", "", "`query` selecting songs to update, e.g. artist:\"queen\" year:1975..1985 -explicit")
+	lvl := fs.String("level", "", "the difficulty `level` ("+strings.Join(difficulties, ", ")+")")
+	rng := fs.String("range", "", "the vocal `range` from lowest to highest note (e.g. A2-E4)")
+	clr := fs.Bool("clear", false, "remove the difficulty from the selected songs")
+	fs.Parse(args)
+
+	qry, err := songsFilter(*ids, *filter, *q)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fs.Usage()
+		return exitConfig
+	}
+
+	upd := bson.M{"$unset": bson.M{"difficulty": ""}}
+	if !*clr {
+		l, ok := parseLevel(*lvl)
+		if !ok {
+			fmt.Printf("Error: level must be one of %s\n", strings.Join(difficulties, ", "))
+			fs.Usage()
+			return exitConfig
+		}
+
+		d := Difficulty{Level: l}
+		if *rng != "" {
+			if d.Low, d.High, err = parseRange(*rng); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				fs.Usage()
+				return exitConfig
+			}
+		}
+
+		upd = bson.M{"$set": bson.M{"difficulty": d}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	res, err := c.Database(karaokeDB).Collection(songsCollection).UpdateMany(ctx, qry, upd)
+	if err != nil {
+		fmt.Printf("Error updating difficulties: %v", err)
+		panic(err)
+	}
+
+	fmt.Printf("Difficulties updated: %d songs matched and %d songs modified\n", res.MatchedCount, res.ModifiedCount)
+
+	return exitOK
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// duplicateSimilarity is the similarity of both the title and the artist
+	// above which a catalog song is a candidate duplicate
+	duplicateSimilarity = 0.8
+	// maxDuplicateMatches is the number of candidates reported for a song
+	maxDuplicateMatches = 3
+)
+
+var skipDuplicates bool
+
+// duplicateMatch is a catalog song a custom song may duplicate
+type duplicateMatch struct {
+	ID         SongID  `bson:"id" json:"id"`
+	Title      string  `bson:"title" json:"title"`
+	Artist     string  `bson:"artist" json:"artist"`
+	Similarity float64 `bson:"similarity" json:"similarity"`
+}
+
+// possibleDuplicate is a custom song and the catalog songs it may duplicate
+type possibleDuplicate struct {
+	ID      SongID           `bson:"id" json:"id"`
+	Title   string           `bson:"title" json:"title"`
+	Artist  string           `bson:"artist" json:"artist"`
+	Matches []duplicateMatch `bson:"matches" json:"matches"`
+}
+
+// catalogEntry is a catalog song and the match key of its title
+type catalogEntry struct {
+	ID     SongID `bson:"id"`
+	Title  string `bson:"title"`
+	Artist string `bson:"artist"`
+	title  string
+}
+
+// similarity compares two match keys by their edit distance, from 0 for
+// nothing in common to 1 for equal keys
+func similarity(a string, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+
+	// the edit distance between the prefixes of a and b, one row at a time
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cst := 1
+			if ra[i-1] == rb[j-1] {
+				cst = 0
+			}
+
+			cur[j] = prev[j-1] + cst
+			if d := prev[j] + 1; d < cur[j] {
+				cur[j] = d
+			}
+
+			if d := cur[j-1] + 1; d < cur[j] {
+				cur[j] = d
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	n := len(ra)
+	if len(rb) > n {
+		n = len(rb)
+	}
+
+	return 1 - float64(prev[len(rb)])/float64(n)
+}
+
+// similarKeys reports whether two keys can reach the threshold, which their
+// lengths alone can rule out before comparing them
+func similarKeys(a string, b string) (float64, bool) {
+	la, lb := len([]rune(a)), len([]rune(b))
+	d, n := la-lb, la
+	if d < 0 {
+		d, n = -d, lb
+	}
+
+	if n > 0 && 1-float64(d)/float64(n) < duplicateSimilarity {
+		return 0, false
+	}
+
+	s := similarity(a, b)
+	return s, s >= duplicateSimilarity
+}
+
+// duplicateMatches returns the catalog songs, grouped by artist key, whose
+// title and artist are both similar to the song's, most similar first
+func duplicateMatches(sng Song, artists map[string][]catalogEntry) []duplicateMatch {
+	ttl, art := matchKey(sng.Title), matchKey(sng.Artist)
+
+	var mtchs []duplicateMatch
+	for ak, ents := range artists {
+		as, ok := similarKeys(art, ak)
+		if !ok {
+			continue
+		}
+
+		for _, ent := range ents {
+			if ts, ok := similarKeys(ttl, ent.title); ok {
+				mtchs = append(mtchs, duplicateMatch{ID: ent.ID, Title: ent.Title, Artist: ent.Artist, Similarity: math.Round((ts+as)/2*100) / 100})
+			}
+		}
+	}
+
+	sort.Slice(mtchs, func(i, j int) bool {
+		if mtchs[i].Similarity != mtchs[j].Similarity {
+			return mtchs[i].Similarity > mtchs[j].Similarity
+		}
+
+		return mtchs[i].ID.Less(mtchs[j].ID)
+	})
+
+	if len(mtchs) > maxDuplicateMatches {
+		mtchs = mtchs[:maxDuplicateMatches]
+	}
+
+	return mtchs
+}
+
+// catalogEntries returns the ID, title, and artist of every catalog song
+func catalogEntries(ctx context.Context, c *mongo.Client) []catalogEntry {
+	cur, err := c.Database(karaokeDB).Collection(songsCollection).Find(
+		ctx,
+		bson.D{},
+		options.Find().SetProjection(bson.M{"_id": 0, "id": 1, "title": 1, "artist": 1}))
+	if err != nil {
+		fmt.Printf("Error retrieving catalog songs: %v", err)
+		panic(err)
+	}
+
+	var ents []catalogEntry
+	if err = cur.All(ctx, &ents); err != nil {
+		fmt.Printf("Error reading catalog songs: %v", err)
+		panic(err)
+	}
+
+	return ents
+}
+
+// checkDuplicates compares the custom songs a supplementary import creates,
+// those not yet in the catalog, with the catalog songs and reports the
+// similarly titled songs by similarly named artists each may duplicate, so
+// they can be merged instead; with skipDuplicates they are left out
+func checkDuplicates(ctx context.Context, c *mongo.Client, sngs []Song) []Song {
+	imp := make(map[SongID]bool, len(sngs))
+	for _, sng := range sngs {
+		imp[sng.ID] = true
+	}
+
+	// group the other catalog songs by the match key of their artist
+	ex := map[SongID]bool{}
+	artists := map[string][]catalogEntry{}
+	for _, ent := range catalogEntries(ctx, c) {
+		ex[ent.ID] = true
+		if imp[ent.ID] {
+			continue
+		}
+
+		ent.title = matchKey(ent.Title)
+		ak := matchKey(ent.Artist)
+		artists[ak] = append(artists[ak], ent)
+	}
+
+	var nsngs []Song
+	for _, sng := range sngs {
+		if !ex[sng.ID] {
+			nsngs = append(nsngs, sng)
+		}
+	}
+
+	dups := map[SongID]bool{}
+	for _, sng := range nsngs {
+		mtchs := duplicateMatches(sng, artists)
+		if len(mtchs) == 0 {
+			continue
+		}
+
+		cands := make([]string, 0, len(mtchs))
+		for _, m := range mtchs {
+			cands = append(cands, fmt.Sprintf("%s (\"%s\" by %s)", m.ID, m.Title, m.Artist))
+		}
+		fmt.Printf("Possible duplicate song (%s): \"%s\" by %s matches %s\n", sng.ID, sng.Title, sng.Artist, strings.Join(cands, ", "))
+
+		dups[sng.ID] = true
+		summary.Duplicates = append(summary.Duplicates, possibleDuplicate{ID: sng.ID, Title: sng.Title, Artist: sng.Artist, Matches: mtchs})
+	}
+
+	if !skipDuplicates || len(dups) == 0 {
+		return sngs
+	}
+
+	ksngs := sngs[:0]
+	for _, sng := range sngs {
+		if dups[sng.ID] {
+			fmt.Printf("Skipping song (%s): possible duplicate\n", sng.ID)
+			continue
+		}
+
+		ksngs = append(ksngs, sng)
+	}
+
+	summary.Skipped += len(sngs) - len(ksngs)
+	return ksngs
+}
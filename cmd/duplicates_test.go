@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"queen", "queen", 1},
+		{"queen", "", 0},
+		{"abcd", "abce", 0.75},
+		{"kitten", "sitting", 1 - 3.0/7},
+		{"été", "ete", 1 - 2.0/3},
+	} {
+		if got := similarity(tc.a, tc.b); math.Abs(got-tc.want) > 1e-9 || similarity(tc.b, tc.a) != got {
+			t.Errorf("similarity(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestDuplicateMatches(t *testing.T) {
+	ents := []catalogEntry{
+		{ID: "6534", Title: "Bohemian Rhapsody", Artist: "Queen"},
+		{ID: "6535", Title: "Bohemian Rhapsody (Live Aid)", Artist: "Queen"},
+		{ID: "7001", Title: "Bicycle Race", Artist: "Queen"},
+		{ID: "8002", Title: "Bohemian Rhapsody", Artist: "Panic! At The Disco"},
+		{ID: "9003", Title: "Don't Stop Me Now", Artist: "Queen + Adam Lambert"},
+	}
+
+	artists := map[string][]catalogEntry{}
+	for _, ent := range ents {
+		ent.title = matchKey(ent.Title)
+		artists[matchKey(ent.Artist)] = append(artists[matchKey(ent.Artist)], ent)
+	}
+
+	for _, tc := range []struct {
+		name string
+		sng  Song
+		want []SongID
+	}{
+		{"same spelling", Song{Title: "Bohemian Rhapsody", Artist: "Queen"}, []SongID{"6534", "6535"}},
+		{"misspelled", Song{Title: "Bohemian Rapsody", Artist: "Queeen"}, []SongID{"6534", "6535"}},
+		{"qualifier", Song{Title: "Bohemian Rhapsody - Karaoke Version", Artist: "queen"}, nil},
+		{"other artist", Song{Title: "Bohemian Rhapsody", Artist: "The Muppets"}, nil},
+		{"other title", Song{Title: "Another One Bites the Dust", Artist: "Queen"}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []SongID
+			for _, m := range duplicateMatches(tc.sng, artists) {
+				got = append(got, m.ID)
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("duplicateMatches = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
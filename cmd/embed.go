@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const songsVectorIndexName = "songs_vector"
+
+var (
+	embeddingKey     = os.Getenv("EMBEDDING_API_KEY")
+	embeddingModel   = "text-embedding-3-small"
+	embeddingTimeout = providerTimeout("EMBEDDING", time.Minute)
+	embeddingURL     = "https://api.openai.com/v1/embeddings"
+)
+
+// embeddingText is the text embedded for a song
+func embeddingText(sng Song) string {
+	return fmt.Sprintf(
+		"%s by %s. Styles: %s. Languages: %s.",
+		sng.Title,
+		sng.Artist,
+		joinValues(sng.Styles, ", "),
+		joinValues(sng.Languages, ", "))
+}
+
+// embeddingHash identifies the text a stored embedding was computed from so
+// songs are only re-embedded when their text changes
+func embeddingHash(txt string) string {
+	h := sha256.Sum256([]byte(embeddingModel + "\n" + txt))
+	return hex.EncodeToString(h[:])
+}
+
+// embed requests embeddings for the inputs from an OpenAI compatible
+// embeddings endpoint, returned in input order; the response is rejected
+// unless it has one vector of dims dimensions for every input (any number
+// of dimensions when dims is 0, as long as the vectors agree)
+func embed(ctx context.Context, inputs []string, dims int) ([][]float64, error) {
+	b, err := json.Marshal(map[string]any{
+		"model": embeddingModel,
+		"input": inputs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, embeddingURL, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if embeddingKey != "" {
+		req.Header.Set("Authorization", "Bearer "+embeddingKey)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("%w by embedding provider: %s", errRateLimited, res.Status)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from embedding provider: %s", res.Status)
+	}
+
+	var er struct {
+		Data []struct {
+			Embedding []float64 `json:"embedding"`
+			Index     int       `json:"index"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&er); err != nil {
+		return nil, err
+	}
+
+	if len(er.Data) != len(inputs) {
+		return nil, fmt.Errorf("embedding provider returned %d embeddings for %d inputs", len(er.Data), len(inputs))
+	}
+
+	vecs := make([][]float64, len(inputs))
+	for _, d := range er.Data {
+		if d.Index < 0 || d.Index >= len(vecs) {
+			return nil, fmt.Errorf("embedding provider returned an unexpected index (%d)", d.Index)
+		}
+
+		if vecs[d.Index] != nil {
+			return nil, fmt.Errorf("embedding provider returned index %d more than once", d.Index)
+		}
+
+		if len(d.Embedding) == 0 {
+			return nil, fmt.Errorf("embedding provider returned an empty embedding for index %d", d.Index)
+		}
+
+		if dims == 0 {
+			dims = len(d.Embedding)
+		}
+
+		if len(d.Embedding) != dims {
+			return nil, fmt.Errorf("embedding provider returned %d dimensions for index %d, expected %d", len(d.Embedding), d.Index, dims)
+		}
+
+		vecs[d.Index] = d.Embedding
+	}
+
+	return vecs, nil
+}
+
+// ensureSongsVectorIndex creates the Atlas Vector Search index for the
+// stored embeddings when it does not exist
+func ensureSongsVectorIndex(ctx context.Context, c *mongo.Client, dims int) {
+	db := c.Database(karaokeDB)
+
+	cur, err := db.Collection(songsCollection).Aggregate(ctx, mongo.Pipeline{
+		bson.D{primitive.E{
+			Key:   "$listSearchIndexes",
+			Value: bson.M{"name": songsVectorIndexName},
+		}},
+	})
+	if err != nil {
+		fmt.Printf("Error retrieving Atlas Search indices (is this an Atlas cluster?): %v", err)
+		panic(err)
+	}
+
+	var eidx []bson.M
+	if err = cur.All(ctx, &eidx); err != nil {
+		fmt.Printf("Error reading Atlas Search indices: %v", err)
+		panic(err)
+	}
+
+	if len(eidx) > 0 {
+		return
+	}
+
+	cmd := bson.D{
+		primitive.E{
+			Key:   "createSearchIndexes",
+			Value: songsCollection,
+		},
+		primitive.E{
+			Key: "indexes",
+			Value: bson.A{bson.M{
+				"name": songsVectorIndexName,
+				"type": "vectorSearch",
+				"definition": bson.M{
+					"fields": bson.A{
+						bson.M{
+							"type":          "vector",
+							"path":          "embedding",
+							"numDimensions": dims,
+							"similarity":    "cosine",
+						},
+						bson.M{
+							"type": "filter",
+							"path": "status",
+						},
+						bson.M{
+							"type": "filter",
+							"path": "explicit",
+						},
+						bson.M{
+							"type": "filter",
+							"path": "mood",
+						},
+					},
+				},
+			}},
+		},
+	}
+
+	if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+		fmt.Printf("Error creating Atlas Vector Search index (%s): %v", songsVectorIndexName, err)
+		panic(err)
+	}
+
+	fmt.Printf("Created Atlas Vector Search index (%s)\n", songsVectorIndexName)
+}
+
+func runEmbed(args []string) int {
+	fs := flag.NewFlagSet("embed", flag.ExitOnError)
+	fs.StringVar(&embeddingURL, "embedding-url", embeddingURL, "`url` of an OpenAI compatible embeddings endpoint")
+	fs.StringVar(&embeddingModel, "embedding-model", embeddingModel, "embedding `model` to request")
+	bs := fs.Int("batch-size", 100, "number of songs embedded per request")
+	all := fs.Bool("all", false, "re-embed every song, not only new or changed songs")
+	sum := fs.String("summary-json", "", "write a JSON summary of the run to this `path` (- for stdout)")
+	fs.StringVar(&pushgatewayURL, "pushgateway", pushgatewayURL, "push the run's metrics to the Prometheus Pushgateway at this `url` when finished (defaults to KARAOKE_PUSHGATEWAY)")
+	fs.Parse(args)
+
+	if *bs < 1 {
+		fmt.Println("Error: -batch-size must be at least 1")
+		fs.Usage()
+		return exitConfig
+	}
+
+	// embedding the whole catalog takes a while, so only bound each batch
+	start := time.Now()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cctx, cancel := context.WithTimeout(ctx, mongoTimeout)
+	defer cancel()
+
+	c := connectMongo(cctx)
+	defer disconnectMongo(c)
+
+	clctn := c.Database(karaokeDB).Collection(songsCollection)
+	cur, err := clctn.Find(ctx, bson.D{}, options.Find().SetProjection(bson.M{"embedding": 0}).SetSort(bson.M{"id": 1}))
+	if err != nil {
+		fmt.Printf("Error retrieving songs: %v", err)
+		panic(err)
+	}
+
+	var sngs []struct {
+		Song          `bson:",inline"`
+		EmbeddingHash string `bson:"embeddingHash"`
+	}
+	if err = cur.All(ctx, &sngs); err != nil {
+		fmt.Printf("Error reading songs: %v", err)
+		panic(err)
+	}
+
+	// find the songs whose embedding is missing or stale
+	var pnd []Song
+	for _, sng := range sngs {
+		if *all || sng.EmbeddingHash != embeddingHash(embeddingText(sng.Song)) {
+			pnd = append(pnd, sng.Song)
+		}
+	}
+
+	// skip batches while the provider is failing; they are embedded next run
+	brk := newBreaker("embedding provider")
+	dims, n, e, skp := 0, 0, 0, 0
+	defer func() {
+		reportEnrichment("embed", *sum, enrichmentSummary{Enriched: n, Failed: e, Skipped: len(pnd) - n - e, Breaker: brk.report()}, start)
+	}()
+	for i := 0; i < len(pnd); i += *bs {
+		if ctx.Err() != nil {
+			fmt.Printf("Embedding interrupted: embedded %d of %d songs\n", n, len(pnd))
+			return exitPartial
+		}
+
+		end := i + *bs
+		if end > len(pnd) {
+			end = len(pnd)
+		}
+
+		btch := pnd[i:end]
+		ok, err := brk.wait(ctx)
+		if err != nil {
+			fmt.Printf("Embedding interrupted: embedded %d of %d songs\n", n, len(pnd))
+			return exitPartial
+		}
+
+		if !ok {
+			skp += len(btch)
+			continue
+		}
+
+		txts := make([]string, 0, len(btch))
+		for _, sng := range btch {
+			txts = append(txts, embeddingText(sng))
+		}
+
+		ectx, ecancel := context.WithTimeout(ctx, embeddingTimeout)
+		// every batch must match the dimensions of the first one stored
+		vecs, err := embed(ectx, txts, dims)
+		ecancel()
+		if err != nil {
+			e += len(btch)
+			brk.failure(err)
+			fmt.Printf("Error embedding songs (%s): %v\n", embeddingURL, err)
+			continue
+		}
+		brk.success()
+
+		wms := make([]mongo.WriteModel, 0, len(btch))
+		for j, sng := range btch {
+			dims = len(vecs[j])
+			wms = append(wms, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"id": sng.ID}).
+				SetUpdate(bson.M{"$set": bson.M{
+					"embedding":     vecs[j],
+					"embeddingHash": embeddingHash(txts[j]),
+				}}))
+		}
+
+		bctx, bcancel := context.WithTimeout(ctx, mongoTimeout)
+		if _, err := clctn.BulkWrite(bctx, wms); err != nil {
+			bcancel()
+			fmt.Printf("Error storing embeddings: %v", err)
+			panic(err)
+		}
+		bcancel()
+
+		n += len(btch)
+		fmt.Printf("Embedded %d of %d songs\n", n, len(pnd))
+	}
+
+	if dims > 0 {
+		ictx, icancel := context.WithTimeout(ctx, mongoTimeout)
+		defer icancel()
+
+		ensureSongsVectorIndex(ictx, c, dims)
+	}
+
+	fmt.Printf("Embedding complete: embedded %d songs (%d already up-to-date)\n", n, len(sngs)-len(pnd))
+
+	if e+skp > 0 {
+		fmt.Printf("Embedding left %d songs stale (%d failed, %d skipped, %s)\n", e+skp, e, skp, brk)
+		return exitPartial
+	}
+
+	return exitOK
+}
+
+func runSemanticSearch(args []string) int {
+	fs := flag.NewFlagSet("semantic-search", flag.ExitOnError)
+	fs.StringVar(&embeddingURL, "embedding-url", embeddingURL, "`url` of an OpenAI compatible embeddings endpoint")
+	fs.StringVar(&embeddingModel, "embedding-model", embeddingModel, "embedding `model` to request (must match the stored embeddings)")
+	q := fs.String("q", "", "the `query` to search for, e.g. \"sad breakup ballads\"")
+	lmt := fs.Int("limit", 10, "maximum number of songs to return")
+	md := fs.String("mood", "", "only return songs with this `mood` (party, hype, emotional, or chill)")
+	fs.Parse(args)
+
+	if strings.TrimSpace(*q) == "" || *lmt < 1 {
+		fmt.Println("Error: a query and a positive limit are required")
+		fs.Usage()
+		return exitConfig
+	}
+
+	flt := bson.M{"status": statusActive}
+	if *md != "" {
+		flt["mood"] = *md
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	vecs, err := embed(ctx, []string{*q}, 0)
+	if err != nil {
+		fmt.Printf("Error embedding query (%s): %v", embeddingURL, err)
+		panic(err)
+	}
+
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	cur, err := c.Database(karaokeDB).Collection(songsCollection).Aggregate(ctx, mongo.Pipeline{
+		bson.D{primitive.E{
+			Key: "$vectorSearch",
+			Value: bson.M{
+				"index":         songsVectorIndexName,
+				"path":          "embedding",
+				"queryVector":   vecs[0],
+				"numCandidates": *lmt * 10,
+				"limit":         *lmt,
+				"filter":        flt,
+			},
+		}},
+		bson.D{primitive.E{
+			Key: "$project",
+			Value: bson.M{
+				"_id":    0,
+				"id":     1,
+				"title":  1,
+				"artist": 1,
+				"score":  bson.M{"$meta": "vectorSearchScore"},
+			},
+		}},
+	})
+	if err != nil {
+		fmt.Printf("Error searching songs: %v", err)
+		panic(err)
+	}
+
+	var res []struct {
+		ID     SongID  `bson:"id"`
+		Title  string  `bson:"title"`
+		Artist string  `bson:"artist"`
+		Score  float64 `bson:"score"`
+	}
+	if err = cur.All(ctx, &res); err != nil {
+		fmt.Printf("Error reading search results: %v", err)
+		panic(err)
+	}
+
+	for _, r := range res {
+		fmt.Printf("%.3f\t%s\t\"%s\" by %s\n", r.Score, r.ID, r.Title, r.Artist)
+	}
+
+	return exitOK
+}
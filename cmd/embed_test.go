@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEmbedResponse(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		res  string
+		dims int
+		err  string
+	}{
+		{"complete", `{"data":[{"index":1,"embedding":[0.3,0.4]},{"index":0,"embedding":[0.1,0.2]}]}`, 0, ""},
+		{"expected dimensions", `{"data":[{"index":0,"embedding":[0.1,0.2]},{"index":1,"embedding":[0.3,0.4]}]}`, 2, ""},
+		{"missing", `{"data":[{"index":0,"embedding":[0.1,0.2]}]}`, 0, "returned 1 embeddings for 2 inputs"},
+		{"duplicate", `{"data":[{"index":0,"embedding":[0.1,0.2]},{"index":0,"embedding":[0.3,0.4]}]}`, 0, "returned index 0 more than once"},
+		{"empty", `{"data":[{"index":0,"embedding":[0.1,0.2]},{"index":1,"embedding":[]}]}`, 0, "empty embedding for index 1"},
+		{"mixed dimensions", `{"data":[{"index":0,"embedding":[0.1,0.2]},{"index":1,"embedding":[0.3]}]}`, 0, "returned 1 dimensions for index 1, expected 2"},
+		{"wrong dimensions", `{"data":[{"index":0,"embedding":[0.1,0.2]},{"index":1,"embedding":[0.3,0.4]}]}`, 3, "returned 2 dimensions for index 0, expected 3"},
+		{"unexpected index", `{"data":[{"index":0,"embedding":[0.1]},{"index":2,"embedding":[0.3]}]}`, 0, "unexpected index (2)"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tc.res)
+			}))
+			defer srv.Close()
+
+			url := embeddingURL
+			embeddingURL = srv.URL
+			defer func() { embeddingURL = url }()
+
+			vecs, err := embed(context.Background(), []string{"one", "two"}, tc.dims)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("embed error = %v, want %s", err, tc.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("embed: %v", err)
+			}
+
+			if vecs[0][0] != 0.1 || vecs[1][0] != 0.3 {
+				t.Errorf("embed = %v, want the vectors in input order", vecs)
+			}
+		})
+	}
+}
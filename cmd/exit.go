@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// exit codes returned by every command so wrappers (cron, systemd) can react
+const (
+	exitOK       = 0 // the command completed successfully
+	exitFailure  = 1 // an unexpected error stopped the command
+	exitConfig   = 2 // the flags or configuration are invalid
+	exitSource   = 3 // the import source could not be read or parsed
+	exitDatabase = 4 // MongoDB could not be reached
+	exitPartial  = 5 // the command completed with errors or was interrupted
+)
+
+// exitError is panicked with to stop a command with a specific exit code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e exitError) Unwrap() error {
+	return e.err
+}
+
+// exitOnPanic converts errors panicked by commands into the exit code
+// contract; runtime errors are bugs and continue to panic with a trace
+func exitOnPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	if _, ok := r.(runtime.Error); ok {
+		stopLogging()
+		panic(r)
+	}
+
+	code := exitFailure
+	if ee, ok := r.(exitError); ok {
+		code = ee.code
+	}
+
+	// errors are printed without a trailing newline where they occur
+	fmt.Println()
+	exit(code)
+}
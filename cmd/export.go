@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// exportBatchSize is the number of songs fetched per cursor batch, which
+// bounds the memory an export uses however large the catalog
+const exportBatchSize = 1000
+
+// songWriter writes songs one at a time in an export format
+type songWriter interface {
+	Write(sng Song) error
+	Flush() error
+}
+
+// csvSongWriter writes songs as CSV in the same layout as the KaraFun export
+type csvSongWriter struct {
+	cw  *csv.Writer
+	hdr bool
+}
+
+func newCSVSongWriter(w io.Writer) *csvSongWriter {
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+
+	return &csvSongWriter{cw: cw}
+}
+
+func (w *csvSongWriter) Write(sng Song) error {
+	if !w.hdr {
+		if err := w.cw.Write(csvHeader); err != nil {
+			return err
+		}
+		w.hdr = true
+	}
+
+	rcrd := []string{
+		string(sng.ID),
+		sng.Title,
+		sng.Artist,
+		strconv.Itoa(sng.Year),
+		formatBool(sng.Duo),
+		formatBool(sng.Explicit),
+		"",
+		joinValues(sng.Styles, ","),
+		joinValues(sng.Languages, ","),
+	}
+
+	if !sng.DateAdded.IsZero() {
+		rcrd[6] = sng.DateAdded.Format("2006-01-02")
+	}
+
+	return w.cw.Write(rcrd)
+}
+
+func (w *csvSongWriter) Flush() error {
+	// an empty export still has a header
+	if !w.hdr {
+		if err := w.cw.Write(csvHeader); err != nil {
+			return err
+		}
+		w.hdr = true
+	}
+
+	w.cw.Flush()
+	return w.cw.Error()
+}
+
+// jsonSongWriter writes songs as JSON lines, with only the fields named
+// when there are any
+type jsonSongWriter struct {
+	enc    *json.Encoder
+	fields []string
+}
+
+func (w jsonSongWriter) Write(sng Song) error {
+	v, err := projectSong(sng, w.fields)
+	if err != nil {
+		return err
+	}
+
+	return w.enc.Encode(v)
+}
+
+func (w jsonSongWriter) Flush() error {
+	return nil
+}
+
+// songFields returns the comma separated song fields, always including the
+// ID, and the projection that fetches only them
+func songFields(v string) ([]string, bson.M, error) {
+	known := map[string]bool{}
+	t := reflect.TypeOf(Song{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		known[name] = true
+	}
+
+	flds, prj := []string{"id"}, bson.M{"_id": 0, "id": 1}
+	for _, f := range splitList(v) {
+		if !known[f] {
+			return nil, nil, fmt.Errorf("unknown field (%s)", f)
+		}
+
+		if f != "id" {
+			flds = append(flds, f)
+			prj[f] = 1
+		}
+	}
+
+	return flds, prj, nil
+}
+
+// projectSong returns the song with only the fields named, or the whole
+// song when none are
+func projectSong(sng Song, fields []string) (any, error) {
+	if len(fields) == 0 {
+		return sng, nil
+	}
+
+	b, err := json.Marshal(sng)
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, err
+	}
+
+	prj := make(map[string]json.RawMessage, len(fields))
+	for _, f := range fields {
+		prj[f] = all[f]
+	}
+
+	return prj, nil
+}
+
+// writeSongs streams the songs of a cursor to a writer, one cursor batch in
+// memory at a time, and returns the number written
+func writeSongs(ctx context.Context, cur *mongo.Cursor, sw songWriter) (int, error) {
+	defer cur.Close(context.Background())
+
+	n := 0
+	for cur.Next(ctx) {
+		var sng Song
+		if err := cur.Decode(&sng); err != nil {
+			return n, err
+		}
+
+		if err := sw.Write(sng); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	if err := cur.Err(); err != nil {
+		return n, err
+	}
+
+	return n, sw.Flush()
+}
+
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("out", "-", "`path` to write the export to (- for stdout)")
+	format := fs.String("format", "csv", "the export `format`: csv (the KaraFun export layout) or jsonl (one JSON song per line)")
+	gz := fs.Bool("gzip", false, "compress the export with gzip")
+	filter := fs.String("filter", "", "MongoDB query `filter` (extended JSON) selecting the songs to export (default all songs)")
+	q := fs.String("q", "", "`query` selecting the songs to export, e.g. status:active -explicit")
+	fields := fs.String("fields", "", "comma separated `fields` to export with jsonl, e.g. title,artist,year (default all; the id is always included)")
+	fs.Parse(args)
+
+	if *format != "csv" && *format != "jsonl" {
+		fmt.Println("Error: -format must be csv or jsonl")
+		fs.Usage()
+		return exitConfig
+	}
+
+	// the CSV keeps the KaraFun export layout
+	prj := bson.M{"embedding": 0}
+	var flds []string
+	if *fields != "" {
+		if *format != "jsonl" {
+			fmt.Println("Error: -fields requires -format jsonl")
+			fs.Usage()
+			return exitConfig
+		}
+
+		var err error
+		if flds, prj, err = songFields(*fields); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			fs.Usage()
+			return exitConfig
+		}
+	}
+
+	qry := bson.M{}
+	if *filter != "" || *q != "" {
+		var err error
+		if qry, err = songsFilter("", *filter, *q); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			fs.Usage()
+			return exitConfig
+		}
+	}
+
+	// exporting the whole catalog can take a while, so only bound connecting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cctx, cancel := context.WithTimeout(ctx, mongoTimeout)
+	defer cancel()
+
+	c := connectMongo(cctx)
+	defer disconnectMongo(c)
+
+	// write files beside their destination and only move them into place
+	// once complete, so an interrupted export never replaces a good one
+	var dst io.Writer = commandStdout()
+	var f *os.File
+	tmp := *out + ".tmp"
+	if *out != "-" {
+		var err error
+		if f, err = os.Create(tmp); err != nil {
+			fmt.Printf("Error creating export (%s): %v", tmp, err)
+			panic(err)
+		}
+		defer f.Close()
+
+		dst = f
+	}
+
+	bw := bufio.NewWriter(dst)
+	dst = bw
+
+	var zw *gzip.Writer
+	if *gz {
+		zw = gzip.NewWriter(bw)
+		dst = zw
+	}
+
+	var sw songWriter = newCSVSongWriter(dst)
+	if *format == "jsonl" {
+		sw = jsonSongWriter{enc: json.NewEncoder(dst), fields: flds}
+	}
+
+	cur, err := c.Database(karaokeDB).Collection(songsCollection).Find(
+		ctx,
+		qry,
+		options.Find().
+			SetBatchSize(exportBatchSize).
+			SetProjection(prj).
+			SetSort(bson.M{"id": 1}))
+	if err != nil {
+		fmt.Printf("Error retrieving songs: %v", err)
+		panic(err)
+	}
+
+	n, err := writeSongs(ctx, cur, sw)
+	if ctx.Err() != nil {
+		// keep the message out of an export written to stdout
+		if *out == "-" {
+			fmt.Fprintf(os.Stderr, "Export interrupted after %d songs\n", n)
+			return exitPartial
+		}
+
+		os.Remove(tmp)
+		fmt.Printf("Export interrupted after %d songs\n", n)
+		return exitPartial
+	}
+
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Printf("Error writing export (%s): %v", *out, err)
+		panic(err)
+	}
+
+	if *out != "-" {
+		// a file that fails to close may be truncated
+		if err := f.Close(); err != nil {
+			os.Remove(tmp)
+			fmt.Printf("Error writing export (%s): %v", *out, err)
+			panic(err)
+		}
+
+		if err := os.Rename(tmp, *out); err != nil {
+			fmt.Printf("Error moving export into place (%s): %v", *out, err)
+			panic(err)
+		}
+
+		fmt.Printf("Exported %d songs to %s\n", n, *out)
+	}
+
+	return exitOK
+}
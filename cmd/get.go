@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// songResult is the song found for a requested ID, following the redirect
+// of a merged song, or a miss
+type songResult struct {
+	ID         SongID `json:"id"`
+	MergedInto SongID `json:"mergedInto,omitempty"`
+	Missing    bool   `json:"missing,omitempty"`
+	Song       any    `json:"song,omitempty"`
+}
+
+// getSongs returns the songs with the IDs in the order requested, fetched
+// with the projection and with only the fields named when there are any;
+// there is one query for the redirects and one for the songs however many
+// are requested
+func getSongs(ctx context.Context, c *mongo.Client, ids []SongID, flds []string, prj bson.M) []songResult {
+	db := c.Database(karaokeDB)
+
+	// resolve the IDs of merged songs to the songs they were merged into
+	cur, err := db.Collection(redirectsCollection).Find(ctx, bson.M{"from": bson.M{"$in": ids}})
+	if err != nil {
+		fmt.Printf("Error retrieving song redirects: %v", err)
+		panic(err)
+	}
+
+	var rdrs []songRedirect
+	if err = cur.All(ctx, &rdrs); err != nil {
+		fmt.Printf("Error reading song redirects: %v", err)
+		panic(err)
+	}
+
+	to := make(map[SongID]SongID, len(rdrs))
+	qids := append([]SongID{}, ids...)
+	for _, r := range rdrs {
+		to[r.From] = r.To
+		qids = append(qids, r.To)
+	}
+
+	cur, err = db.Collection(songsCollection).Find(
+		ctx,
+		bson.M{"id": bson.M{"$in": qids}},
+		options.Find().SetProjection(prj))
+	if err != nil {
+		fmt.Printf("Error retrieving songs: %v", err)
+		panic(err)
+	}
+
+	var sngs []Song
+	if err = cur.All(ctx, &sngs); err != nil {
+		fmt.Printf("Error reading songs: %v", err)
+		panic(err)
+	}
+
+	byID := make(map[SongID]*Song, len(sngs))
+	for i := range sngs {
+		byID[sngs[i].ID] = &sngs[i]
+	}
+
+	res := make([]songResult, 0, len(ids))
+	for _, id := range ids {
+		r := songResult{ID: id, MergedInto: to[id]}
+		sng := byID[id]
+		if r.MergedInto != "" {
+			sng = byID[r.MergedInto]
+		}
+
+		if sng != nil {
+			if r.Song, err = projectSong(*sng, flds); err != nil {
+				fmt.Printf("Error projecting song (%s): %v", sng.ID, err)
+				panic(err)
+			}
+		}
+		r.Missing = sng == nil
+
+		res = append(res, r)
+	}
+
+	return res
+}
+
+func runGet(args []string) int {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	ids := fs.String("ids", "", "comma separated song `ids` to get, printed in this order")
+	fields := fs.String("fields", "", "comma separated `fields` to get, e.g. title,artist (default all; the id is always included)")
+	fs.Parse(args)
+
+	flds, prj := []string(nil), bson.M{"embedding": 0}
+	if *fields != "" {
+		var err error
+		if flds, prj, err = songFields(*fields); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			fs.Usage()
+			return exitConfig
+		}
+	}
+
+	var sids []SongID
+	for _, v := range splitList(*ids) {
+		id, err := parseSongID(v)
+		if err != nil {
+			fmt.Printf("Error: invalid song id: %s\n", v)
+			fs.Usage()
+			return exitConfig
+		}
+
+		sids = append(sids, id)
+	}
+
+	if len(sids) == 0 {
+		fmt.Println("Error: -ids is required")
+		fs.Usage()
+		return exitConfig
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	// one JSON result per line, so the output lines up with the request
+	enc := json.NewEncoder(os.Stdout)
+	miss := 0
+	for _, r := range getSongs(ctx, c, sids, flds, prj) {
+		if r.Missing {
+			miss++
+		}
+
+		if err := enc.Encode(r); err != nil {
+			fmt.Printf("Error writing song (%s): %v", r.ID, err)
+			panic(err)
+		}
+	}
+
+	if miss > 0 {
+		return exitPartial
+	}
+
+	return exitOK
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	// hookLineKey holds the source line of each record passed to
+	// pre-validate hooks, so records they keep are still traced to it
+	hookLineKey = "_line"
+
+	hookPreValidate hookStage = "pre-validate"
+	hookTransform   hookStage = "transform"
+	hookPostPersist hookStage = "post-persist"
+)
+
+var (
+	hookBatchSize = 500
+	hookCmds      = hookCommands{}
+	recordHooks   = map[hookStage][]recordHook{}
+	songHooks     = map[hookStage][]songHook{}
+)
+
+// hookStage identifies a point in the import pipeline where hooks run
+type hookStage string
+
+// recordHook receives raw CSV records (keyed by header, with the source line
+// under _line) before they are parsed and validated and returns the records
+// to keep
+type recordHook func(rcrds []map[string]string) ([]map[string]string, error)
+
+// songHook receives a batch of parsed songs and returns the songs to keep;
+// the return value is ignored for the post-persist stage
+type songHook func(sngs []Song) ([]Song, error)
+
+// hookCommands holds external commands (stage=command) provided via flags
+type hookCommands map[hookStage][]string
+
+func (hc hookCommands) String() string {
+	var s strings.Builder
+	for _, stg := range []hookStage{hookPreValidate, hookTransform, hookPostPersist} {
+		for _, cmd := range hc[stg] {
+			if s.Len() > 0 {
+				fmt.Fprint(&s, ",")
+			}
+
+			fmt.Fprintf(&s, "%s=%s", stg, cmd)
+		}
+	}
+
+	return s.String()
+}
+
+func (hc hookCommands) Set(v string) error {
+	stg, cmd, ok := strings.Cut(v, "=")
+	if !ok || strings.TrimSpace(cmd) == "" {
+		return fmt.Errorf("hook must be in the form stage=command: %s", v)
+	}
+
+	switch hookStage(stg) {
+	case hookPreValidate, hookTransform, hookPostPersist:
+		hc[hookStage(stg)] = append(hc[hookStage(stg)], cmd)
+		return nil
+	default:
+		return fmt.Errorf("unknown hook stage: %s", stg)
+	}
+}
+
+// registerRecordHook adds a Go hook for the pre-validate stage
+func registerRecordHook(h recordHook) {
+	recordHooks[hookPreValidate] = append(recordHooks[hookPreValidate], h)
+}
+
+// registerSongHook adds a Go hook for the transform or post-persist stage;
+// songs are not run through hooks at any other stage, so registering one
+// there is a mistake
+func registerSongHook(stg hookStage, h songHook) {
+	if stg != hookTransform && stg != hookPostPersist {
+		panic(fmt.Sprintf("song hooks run at the %s and %s stages, not %s", hookTransform, hookPostPersist, stg))
+	}
+
+	songHooks[stg] = append(songHooks[stg], h)
+}
+
+// batchEnd returns the exclusive end of the hook batch starting at i
+func batchEnd(i, n int) int {
+	if i+hookBatchSize < n {
+		return i + hookBatchSize
+	}
+
+	return n
+}
+
+// runExternalHook pipes a JSON batch to a command via stdin and decodes the
+// JSON written to stdout (when out is not nil)
+func runExternalHook(cmd string, in any, out any) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	var stdout bytes.Buffer
+	c := exec.Command("sh", "-c", cmd)
+	c.Stdin = bytes.NewReader(b)
+	c.Stdout = &stdout
+	c.Stderr = os.Stderr
+
+	if err := c.Run(); err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.Unmarshal(stdout.Bytes(), out)
+}
+
+func runRecordHooks(hdr []string, rcrds []sourceRecord) []sourceRecord {
+	if len(recordHooks[hookPreValidate]) == 0 && len(hookCmds[hookPreValidate]) == 0 {
+		return rcrds
+	}
+
+	// key each record by the header, along with its source line
+	krs := make([]map[string]string, 0, len(rcrds))
+	for _, rcrd := range rcrds {
+		kr := make(map[string]string, len(hdr)+1)
+		for i, h := range hdr {
+			if i < len(rcrd.fields) {
+				kr[h] = rcrd.fields[i]
+			}
+		}
+		kr[hookLineKey] = strconv.Itoa(rcrd.line)
+
+		krs = append(krs, kr)
+	}
+
+	// run Go hooks across all records
+	for _, h := range recordHooks[hookPreValidate] {
+		var err error
+		if krs, err = h(krs); err != nil {
+			fmt.Printf("Error running %s hook: %v", hookPreValidate, err)
+			panic(err)
+		}
+	}
+
+	// run external commands per batch
+	for _, cmd := range hookCmds[hookPreValidate] {
+		res := make([]map[string]string, 0, len(krs))
+		for i := 0; i < len(krs); i += hookBatchSize {
+			var out []map[string]string
+			if err := runExternalHook(cmd, krs[i:batchEnd(i, len(krs))], &out); err != nil {
+				fmt.Printf("Error running %s hook (%s): %v", hookPreValidate, cmd, err)
+				panic(err)
+			}
+
+			res = append(res, out...)
+		}
+
+		krs = res
+	}
+
+	// convert back to records in header order; records without a valid
+	// source line were added by a hook
+	rcrds = make([]sourceRecord, 0, len(krs))
+	for _, kr := range krs {
+		rcrd := sourceRecord{fields: make([]string, len(hdr))}
+		for i, h := range hdr {
+			rcrd.fields[i] = kr[h]
+		}
+
+		if ln, err := strconv.Atoi(kr[hookLineKey]); err == nil && ln > 1 {
+			rcrd.line = ln
+		}
+
+		rcrds = append(rcrds, rcrd)
+	}
+
+	return rcrds
+}
+
+func runSongHooks(stg hookStage, sngs []Song) []Song {
+	// run Go hooks across all songs
+	for _, h := range songHooks[stg] {
+		res, err := h(sngs)
+		if err != nil {
+			fmt.Printf("Error running %s hook: %v", stg, err)
+			panic(err)
+		}
+
+		if stg != hookPostPersist {
+			sngs = res
+		}
+	}
+
+	// run external commands per batch
+	for _, cmd := range hookCmds[stg] {
+		res := make([]Song, 0, len(sngs))
+		for i := 0; i < len(sngs); i += hookBatchSize {
+			btch := sngs[i:batchEnd(i, len(sngs))]
+
+			// output from post-persist hooks is not used
+			if stg == hookPostPersist {
+				if err := runExternalHook(cmd, btch, nil); err != nil {
+					fmt.Printf("Error running %s hook (%s): %v", stg, cmd, err)
+					panic(err)
+				}
+
+				continue
+			}
+
+			var out []Song
+			if err := runExternalHook(cmd, btch, &out); err != nil {
+				fmt.Printf("Error running %s hook (%s): %v", stg, cmd, err)
+				panic(err)
+			}
+
+			res = append(res, out...)
+		}
+
+		if stg != hookPostPersist {
+			sngs = res
+		}
+	}
+
+	return sngs
+}
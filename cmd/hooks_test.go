@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestRegisterSongHookStages(t *testing.T) {
+	t.Cleanup(func() { songHooks = map[hookStage][]songHook{} })
+
+	keep := func(sngs []Song) ([]Song, error) { return sngs, nil }
+	for _, tc := range []struct {
+		stg   hookStage
+		panic bool
+	}{
+		{hookTransform, false},
+		{hookPostPersist, false},
+		{hookPreValidate, true},
+		{hookStage("post-validate"), true},
+	} {
+		t.Run(string(tc.stg), func(t *testing.T) {
+			defer func() {
+				if r := recover(); (r != nil) != tc.panic {
+					t.Errorf("registerSongHook(%s) panic = %v, want panic %t", tc.stg, r, tc.panic)
+				}
+			}()
+
+			registerSongHook(tc.stg, keep)
+		})
+	}
+
+	if len(songHooks[hookTransform]) != 1 || len(songHooks[hookPostPersist]) != 1 || len(songHooks[hookPreValidate]) != 0 {
+		t.Errorf("song hooks = %v, want one transform and one post-persist hook", songHooks)
+	}
+}
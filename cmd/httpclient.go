@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	// httpCacheDir holds cached integration responses; empty disables the
+	// cache
+	httpCacheDir = os.Getenv("KARAOKE_HTTP_CACHE")
+	// httpCacheTTL is how long cached responses are used, in hours
+	httpCacheTTL = envInt("KARAOKE_HTTP_CACHE_TTL", 24)
+	// httpProxy is the proxy for integration calls, defaulting to the
+	// standard HTTPS_PROXY, HTTP_PROXY, and NO_PROXY variables
+	httpProxy = os.Getenv("KARAOKE_HTTP_PROXY")
+	// httpTransport is shared by every outbound integration call
+	httpTransport = newHTTPTransport()
+	// httpClient makes the integration calls whose responses are never
+	// cached, such as catalog downloads
+	httpClient = &http.Client{Transport: httpTransport}
+	// enrichmentClient makes the enrichment lookups, whose responses are
+	// cached when httpCacheDir is set
+	enrichmentClient = newEnrichmentClient()
+)
+
+// providerTimeout returns the timeout for calls to an integration, which
+// KARAOKE_HTTP_TIMEOUT_<provider> overrides in seconds
+func providerTimeout(provider string, def time.Duration) time.Duration {
+	if n := envInt("KARAOKE_HTTP_TIMEOUT_"+provider, 0); n > 0 {
+		return time.Duration(n) * time.Second
+	}
+
+	return def
+}
+
+func newHTTPTransport() http.RoundTripper {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if httpProxy != "" {
+		// an invalid proxy fails each call rather than bypassing the proxy
+		u, err := url.Parse(httpProxy)
+		tr.Proxy = func(*http.Request) (*url.URL, error) {
+			return u, err
+		}
+	}
+
+	// failures are injected beneath the cache, as the network would fail
+	return chaosTransport(tr)
+}
+
+func newEnrichmentClient() *http.Client {
+	if httpCacheDir == "" {
+		return httpClient
+	}
+
+	return &http.Client{Transport: &cachingTransport{
+		dir:  httpCacheDir,
+		next: httpTransport,
+		ttl:  time.Duration(httpCacheTTL) * time.Hour,
+	}}
+}
+
+// cachingTransport keeps successful responses to plain GET requests on disk,
+// keyed by URL, so repeated enrichment runs do not repeat the same lookups;
+// authorized and conditional requests always go to the server
+type cachingTransport struct {
+	dir  string
+	next http.RoundTripper
+	ttl  time.Duration
+}
+
+// cacheable reports whether a request's response may be cached
+func cacheable(req *http.Request) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+
+	for _, h := range []string{"Authorization", "If-Modified-Since", "If-None-Match"} {
+		if req.Header.Get(h) != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// path returns the cache file of a URL
+func (t *cachingTransport) path(u *url.URL) string {
+	h := sha256.Sum256([]byte(u.String()))
+	return filepath.Join(t.dir, hex.EncodeToString(h[:]))
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !cacheable(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	p := t.path(req.URL)
+	if fi, err := os.Stat(p); err == nil && time.Since(fi.ModTime()) < t.ttl {
+		if b, err := os.ReadFile(p); err == nil {
+			if res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), req); err == nil {
+				return res, nil
+			}
+		}
+	}
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusOK {
+		return res, err
+	}
+
+	b, err := httputil.DumpResponse(res, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// caching is best effort, a failed write only costs a repeated lookup
+	if err := os.MkdirAll(t.dir, 0755); err == nil {
+		if err := os.WriteFile(p, b, 0644); err != nil {
+			fmt.Printf("Error caching response (%s): %v\n", req.URL.Host, err)
+		}
+	}
+
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), req)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCachingTransport(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	clnt := &http.Client{Transport: &cachingTransport{
+		dir:  t.TempDir(),
+		next: http.DefaultTransport,
+		ttl:  time.Hour,
+	}}
+
+	get := func(path string, hdr ...string) string {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		if err != nil {
+			t.Fatalf("creating request: %v", err)
+		}
+
+		for i := 0; i+1 < len(hdr); i += 2 {
+			req.Header.Set(hdr[i], hdr[i+1])
+		}
+
+		res, err := clnt.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer res.Body.Close()
+
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("reading %s: %v", path, err)
+		}
+
+		return string(b)
+	}
+
+	for i := 0; i < 2; i++ {
+		if b := get("/search"); b != "/search" {
+			t.Fatalf("response = %q, want /search", b)
+		}
+	}
+
+	if hits != 1 {
+		t.Errorf("server hit %d times for a cached lookup, want 1", hits)
+	}
+
+	get("/search", "Authorization", "Bearer key")
+	get("/search", "If-None-Match", `"etag"`)
+	if hits != 3 {
+		t.Errorf("server hit %d times, want authorized and conditional requests to skip the cache", hits)
+	}
+}
+
+func TestHTTPClientUncached(t *testing.T) {
+	if _, ok := httpClient.Transport.(*cachingTransport); ok {
+		t.Errorf("httpClient caches responses, so catalog downloads could be stale")
+	}
+}
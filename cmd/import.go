@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// upsertBatchSize is the number of songs written per bulk write
+const upsertBatchSize = 500
+
+func runImport(args []string) (code int) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.Var(&hookCmds, "hook", "external `stage=command` run per batch of records (pre-validate, transform, post-persist); may be repeated")
+	fs.BoolVar(&staging, "staging", false, "import into a staging collection and swap it into place once validated")
+	fs.BoolVar(&supplementary, "supplementary", false, "the source adds to the catalog instead of holding all of its songs, so songs it leaves out are not marked unavailable")
+	fs.BoolVar(&snapshotCatalog, "snapshot", false, "copy the catalog into a point-in-time snapshot after the import")
+	fs.IntVar(&snapshotKeep, "snapshot-keep", snapshotKeep, "number of snapshots to retain after taking one (0 keeps all)")
+	fs.StringVar(&regionsPath, "regions-file", "", "`path` to a CSV of song IDs and the comma separated regions each is licensed in")
+	fs.StringVar(&region, "region", "", "only import songs licensed in this `region` (e.g. US)")
+	fs.StringVar(&summaryPath, "summary-json", "", "write a JSON summary of the import to this `path` (- for stdout)")
+	fs.StringVar(&sheetID, "sheet", "", "import from the Google Sheet with this spreadsheet `id` instead of the CSV")
+	fs.StringVar(&sheetRange, "sheet-range", sheetRange, "the A1 notation `range` of the sheet holding the catalog, header first")
+	fs.StringVar(&karafunURL, "karafun", "", "import the live catalog from this KaraFun catalog `url` instead of the CSV")
+	fs.BoolVar(&forceImport, "force", false, "import the KaraFun catalog even when it has not changed since the last import")
+	fs.StringVar(&sheetCredentials, "sheet-credentials", sheetCredentials, "`path` to the service account key file (defaults to GOOGLE_APPLICATION_CREDENTIALS)")
+	fs.BoolVar(&atlasSearch, "atlas-search", false, "create or update the Atlas Search index for the catalog (Atlas clusters only)")
+	fs.StringVar(&telemetryEndpoint, "telemetry-endpoint", "", "opt in to sending anonymous usage statistics to this `url` (off by default)")
+	fs.Func("notify-webhook", "post new songs as JSON to this webhook `url` after the import; may be repeated", addWebhook)
+	fs.Func("notify-secret", "sign deliveries to the preceding -notify-webhook with this `secret` (defaults to KARAOKE_WEBHOOK_SECRET)", setWebhookSecret)
+	fs.Func("notify-slack", "post new songs to this Slack incoming webhook `url` after the import; may be repeated", func(v string) error {
+		notifySlack = append(notifySlack, v)
+		return nil
+	})
+	fs.StringVar(&notifyTemplatePath, "notify-template", notifyTemplatePath, "`path` to a text/template file redefining the notification messages (defaults to KARAOKE_NOTIFY_TEMPLATE)")
+	fs.StringVar(&licensesPath, "licenses-file", "", "`path` to a CSV of catalog sources and license expiry dates to warn about before importing")
+	fs.IntVar(&licenseWarnDays, "license-warn-days", licenseWarnDays, "warn about licenses expiring within this many `days`")
+	fs.BoolVar(&filterExpired, "filter-expired", false, "withdraw the songs of a source with an expired license instead of importing it")
+	fs.StringVar(&songLink, "song-link", songLink, "`template` of the KaraFun link to each announced song, {id} is replaced by the song ID (empty for no links)")
+	fs.StringVar(&schemaStrictness, "schema-strictness", schemaStrictness, "the validator `strictness` ("+strings.Join(schemaStrictnesses, ", ")+"; defaults to KARAOKE_SCHEMA_STRICTNESS or moderate)")
+	fs.Func("conflict", "`field=policy` for fields edited locally since the last import (keep-mine, take-theirs, or merge for lists); field may be a class (text, details, lists); may be repeated", setConflictPolicy)
+	fs.Func("protect", "comma separated `fields` imports never overwrite on existing songs (defaults to KARAOKE_PROTECTED_FIELDS); may be repeated", protectFields)
+	fs.StringVar(&pushgatewayURL, "pushgateway", pushgatewayURL, "push the import's metrics to the Prometheus Pushgateway at this `url` when finished (defaults to KARAOKE_PUSHGATEWAY)")
+	fs.BoolVar(&skipDuplicates, "skip-duplicates", false, "leave out custom songs of a supplementary import (-supplementary or -sheet) that may duplicate a catalog song")
+	fs.BoolVar(&preflight, "preflight", false, "estimate the documents, storage, and index growth of the import and exit without writing")
+	fs.Float64Var(&storageLimitMB, "storage-limit-mb", 0, "warn when the estimated catalog size exceeds this storage `limit` in megabytes (e.g. 10240 for an M10)")
+	fs.Float64Var(&maxOpsPerSec, "max-ops-per-sec", 0, "maximum song writes per second, backing off further under cluster pressure (0 is unlimited)")
+	fs.IntVar(&hookBatchSize, "hook-batch-size", hookBatchSize, "number of records sent to each external hook invocation")
+	fs.Func("bool-true", "comma separated additional `values` parsed as true for duo/explicit", func(v string) error {
+		addBoolValues(trueValues, v)
+		return nil
+	})
+	fs.Func("bool-false", "comma separated additional `values` parsed as false for duo/explicit", func(v string) error {
+		addBoolValues(falseValues, v)
+		return nil
+	})
+	fs.Func("date-formats", "comma separated Go `layouts` tried in order for the date added (default \""+strings.Join(dateFormats, ",")+"\")", setDateFormats)
+	if err := protectFields(os.Getenv("KARAOKE_PROTECTED_FIELDS")); err != nil {
+		fmt.Printf("Error: KARAOKE_PROTECTED_FIELDS: %v\n", err)
+		return exitConfig
+	}
+	fs.Parse(args)
+
+	if hookBatchSize < 1 {
+		fmt.Println("Error: -hook-batch-size must be at least 1")
+		fs.Usage()
+		return exitConfig
+	}
+
+	if maxOpsPerSec < 0 {
+		fmt.Println("Error: -max-ops-per-sec can not be negative")
+		fs.Usage()
+		return exitConfig
+	}
+
+	if err := loadNotifyTemplates(); err != nil {
+		fmt.Printf("Error: invalid notification templates: %v\n", err)
+		fs.Usage()
+		return exitConfig
+	}
+
+	if !validStrictness() {
+		fmt.Printf("Error: -schema-strictness must be one of %s\n", strings.Join(schemaStrictnesses, ", "))
+		fs.Usage()
+		return exitConfig
+	}
+
+	// read the songs from the sheet or KaraFun when named, otherwise the CSV
+	var src source = csvSource{path: karaokeFilePath}
+	switch {
+	case sheetID != "":
+		// sheets hold wish lists and custom songs, not the full catalog
+		src = sheetSource{credentials: sheetCredentials, id: sheetID, rng: sheetRange}
+		supplementary = true
+	case karafunURL != "":
+		src = &karafunSource{url: karafunURL}
+	}
+
+	// only supplementary imports create custom songs
+	if skipDuplicates && !supplementary {
+		fmt.Println("Error: -skip-duplicates requires a supplementary import (-supplementary or -sheet)")
+		fs.Usage()
+		return exitConfig
+	}
+
+	// staging swaps the whole catalog into place
+	if staging && supplementary {
+		fmt.Println("Error: -staging can not be used with a supplementary import (-supplementary or -sheet)")
+		fs.Usage()
+		return exitConfig
+	}
+
+	// write the summary and push the metrics when finished, including any
+	// error that stopped the import before it completed
+	start := time.Now()
+	defer func() {
+		if summaryPath == "" && pushgatewayURL == "" {
+			return
+		}
+
+		r := recover()
+		if r != nil {
+			summary.Errors = append(summary.Errors, fmt.Sprint(r))
+		}
+
+		summary.DurationMs = time.Since(start).Milliseconds()
+		if summaryPath != "" {
+			writeSummary(summaryPath, summary)
+		}
+
+		// imports that skipped some records still completed
+		intr := len(summary.Errors) > 0 && summary.Errors[len(summary.Errors)-1] == interruptedError
+		pushImportMetrics(src.String(), r == nil && (code == exitOK || (code == exitPartial && !intr)), start)
+
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	// warn about lapsing licenses before anything is read or written
+	if licensesPath != "" {
+		lctx, lcancel := context.WithTimeout(context.Background(), mongoTimeout)
+		exp := checkLicenses(lctx, readLicenses(licensesPath))
+		if exp[src.String()] && filterExpired {
+			withdrawExpired(lctx, exp)
+			lcancel()
+
+			err := fmt.Errorf("license for %s has expired", src)
+			fmt.Printf("Error importing songs: %v\n", err)
+			summary.Errors = append(summary.Errors, err.Error())
+			return exitSource
+		}
+		lcancel()
+	}
+
+	// skip downloading and writing a live catalog that has not changed
+	if ks, ok := src.(*karafunSource); ok && !forceImport {
+		ks.prior = lastImportRun(ks)
+
+		chg, err := ks.changed()
+		if err != nil {
+			fmt.Printf("Error reading source (%s): %v", ks, err)
+			panic(exitError{exitSource, err})
+		}
+
+		if !chg {
+			recordUnchangedSync(ks, time.Now())
+			fmt.Printf("Catalog unchanged since the last import (%s), nothing to import\n", ks)
+			return exitOK
+		}
+	}
+
+	sngs := readSongs(src)
+
+	// stop cleanly when interrupted or terminated
+	sctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// connect to the database; the writes are bounded per batch since a
+	// throttled import can take much longer than mongoTimeout
+	ctx, cancel := context.WithTimeout(sctx, mongoTimeout)
+	defer cancel()
+
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	// leave out duplicates that were merged into other songs
+	sngs = skipMerged(ctx, c, sngs)
+
+	// only estimate the impact of the import when requested
+	if preflight {
+		preflightEstimate(ctx, c, sngs)
+		return exitOK
+	}
+
+	// songs a supplementary source adds to the catalog are custom songs,
+	// which may duplicate a catalog song under a different spelling
+	if supplementary {
+		sngs = checkDuplicates(ctx, c, sngs)
+	}
+
+	// when staging, import into an empty copy of the collection and track
+	// which songs already exist in the live catalog for the summary
+	tgt := songsCollection
+	var lids map[SongID]bool
+	if staging {
+		tgt = stagingCollection
+		lids = prepareStagingCollection(ctx, c)
+	}
+
+	// ensure the collection is created with indices as appropriate
+	ensureSongsCollection(ctx, c, tgt)
+	ensureSongsIndices(ctx, c, tgt)
+
+	// upsert the songs into MongoDB in batches
+	clctn := c.Database(karaokeDB).Collection(tgt)
+	// every write stamps the provenance, so songs are unchanged when none
+	// of their imported fields differ
+	p, u := 0, 0
+	thr := newThrottle(maxOpsPerSec)
+	var added []Song
+	for i := 0; i < len(sngs); i += upsertBatchSize {
+		// finish with the songs written so far when interrupted
+		if sctx.Err() != nil {
+			break
+		}
+
+		end := i + upsertBatchSize
+		if end > len(sngs) {
+			end = len(sngs)
+		}
+
+		btch := sngs[i:end]
+
+		// compare with the live catalog to resolve conflicts with local
+		// edits and report the fields that change
+		ectx, ecancel := context.WithTimeout(sctx, mongoTimeout)
+		ex := existingSongs(ectx, c, btch)
+		ecancel()
+
+		wms := make([]mongo.WriteModel, 0, len(btch))
+		wrt := make([]Song, 0, len(btch))
+		at := time.Now().UTC()
+		for _, sng := range btch {
+			fmt.Printf("Upserting song (%s): \"%s\" by %s\n", sng.ID, sng.Title, sng.Artist)
+
+			// the provenance records the provider's values, not the edits
+			// kept in their place
+			ws := sng
+			if old, ok := ex[sng.ID]; ok {
+				var kept []string
+				if ws, kept = resolveConflicts(sng, old); len(kept) > 0 {
+					fmt.Printf("Kept local edits to song (%s): %s\n", sng.ID, strings.Join(kept, ", "))
+					summary.Conflicts++
+				}
+				ws = keepProtected(ws, old.Song)
+			}
+			wrt = append(wrt, ws)
+
+			upd, err := songUpdate(importedSong{ws, provenanceOf(sng, at)})
+			if err != nil {
+				fmt.Printf("Error encoding song (%s): %v", sng.ID, err)
+				panic(err)
+			}
+
+			wms = append(wms, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"id": sng.ID}).
+				SetUpdate(upd).
+				SetUpsert(true))
+		}
+
+		res, err := thr.write(sctx, clctn, wms)
+
+		// the batch may only be partly applied when interrupted mid-flight
+		if err != nil && sctx.Err() != nil {
+			break
+		}
+
+		if err != nil {
+			fmt.Printf("Error upserting songs (%s to %s): %v", btch[0].ID, btch[len(btch)-1].ID, err)
+			panic(err)
+		}
+
+		p += len(btch)
+
+		for _, sng := range wrt {
+			old, ok := ex[sng.ID]
+			if !ok {
+				continue
+			}
+
+			if chgs := songDiff(old.Song, sng); len(chgs) > 0 {
+				recordChanges(sng, chgs)
+				continue
+			}
+
+			u++
+		}
+
+		// track newly inserted songs; staged songs are all inserted, so
+		// they are compared with the live catalog instead
+		if staging {
+			for _, sng := range btch {
+				if !lids[sng.ID] {
+					added = append(added, sng)
+				}
+			}
+
+			continue
+		}
+
+		for j, sng := range btch {
+			if _, ok := res.UpsertedIDs[int64(j)]; ok {
+				added = append(added, sng)
+			}
+		}
+	}
+	n := len(added)
+
+	// bound the remaining steps from when the writes finished
+	ctx, cancel = context.WithTimeout(sctx, mongoTimeout)
+	defer cancel()
+
+	// leave the live catalog untouched when interrupted while staging, and
+	// only mark songs missing from the import once every song was written
+	if sctx.Err() == nil {
+		if staging {
+			swapStagingCollection(ctx, c, sngs)
+		} else {
+			updateStatuses(ctx, clctn, sngs)
+		}
+
+		// the search index is managed on the live collection
+		if atlasSearch {
+			ensureSongsSearchIndex(ctx, c, songsCollection)
+		}
+	}
+
+	// notify hooks of the persisted songs
+	runSongHooks(hookPostPersist, sngs[:p])
+
+	summary.Inserted, summary.Updated, summary.Unchanged = n, p-n-u, u
+	if sctx.Err() != nil {
+		summary.Errors = append(summary.Errors, interruptedError)
+		recordImportRun(c, start, src, sngs)
+		if staging {
+			fmt.Printf("Import interrupted: %s was not swapped into place\n", stagingCollection)
+			return exitPartial
+		}
+
+		fmt.Printf("Import interrupted: inserted %d songs and updated %d songs before stopping (%d unchanged)\n", summary.Inserted, summary.Updated, summary.Unchanged)
+		return exitPartial
+	}
+
+	// keep a point-in-time copy of the catalog
+	if snapshotCatalog {
+		takeSnapshot(ctx, c)
+
+		if snapshotKeep > 0 {
+			pruneSnapshots(ctx, c, snapshotKeep)
+		}
+	}
+
+	notifyNewSongs(ctx, added)
+	sendTelemetry(ctx, c, fs)
+	recordImportRun(c, start, src, sngs)
+
+	fmt.Printf("Import complete: inserted %d songs and updated %d songs (%d unchanged)!\n", summary.Inserted, summary.Updated, summary.Unchanged)
+
+	// some records could not be imported
+	if len(summary.Errors) > 0 {
+		fmt.Printf("Import completed with %d errors\n", len(summary.Errors))
+		return exitPartial
+	}
+
+	return exitOK
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testMongoURI names a disposable MongoDB server for the integration tests,
+// which only run when it is set; each test works in collections of its own
+var testMongoURI = os.Getenv("KARAOKE_TEST_MONGO_URI")
+
+// testSongs connects to the test server and returns a new songs collection,
+// created the way imports create it and dropped when the test ends
+func testSongs(t *testing.T) (context.Context, *mongo.Client, *mongo.Collection) {
+	t.Helper()
+
+	if testMongoURI == "" {
+		t.Skip("KARAOKE_TEST_MONGO_URI is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	t.Cleanup(cancel)
+
+	c, err := mongo.Connect(ctx, options.Client().ApplyURI(testMongoURI).SetRegistry(songsRegistry))
+	if err != nil {
+		t.Fatalf("connecting to %s: %v", testMongoURI, err)
+	}
+	t.Cleanup(func() { c.Disconnect(context.Background()) })
+
+	if err := c.Ping(ctx, nil); err != nil {
+		t.Fatalf("reaching %s: %v", testMongoURI, err)
+	}
+
+	loadEmbeddedDefinitions(t)
+
+	name := fmt.Sprintf("songs_test_%s", primitive.NewObjectID().Hex())
+	ensureSongsCollection(ctx, c, name)
+	ensureSongsIndices(ctx, c, name)
+
+	clctn := c.Database(karaokeDB).Collection(name)
+	t.Cleanup(func() { clctn.Drop(context.Background()) })
+
+	return ctx, c, clctn
+}
+
+// importTestSongs writes songs the way an import does, from the source
+func importTestSongs(t *testing.T, ctx context.Context, clctn *mongo.Collection, src string, sngs ...Song) {
+	t.Helper()
+
+	sourceName = src
+	t.Cleanup(func() { sourceName = "" })
+
+	wms := make([]mongo.WriteModel, 0, len(sngs))
+	for _, sng := range sngs {
+		upd, err := songUpdate(importedSong{sng, provenanceOf(sng, time.Now())})
+		if err != nil {
+			t.Fatalf("songUpdate(%s): %v", sng.ID, err)
+		}
+
+		wms = append(wms, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"id": sng.ID}).
+			SetUpdate(upd).
+			SetUpsert(true))
+	}
+
+	if _, err := clctn.BulkWrite(ctx, wms); err != nil {
+		t.Fatalf("writing songs: %v", err)
+	}
+}
+
+// testSong returns a valid song with the ID
+func testSong(id SongID, title string) Song {
+	return Song{
+		ID:        id,
+		Title:     title,
+		Artist:    "Anon Artist",
+		Year:      1985,
+		DateAdded: time.Date(2019, 3, 14, 0, 0, 0, 0, time.UTC),
+		Styles:    []Style{"Pop"},
+		Languages: []Language{"English"},
+		Regions:   []string{},
+	}
+}
+
+func TestIntegrationCollectionSetup(t *testing.T) {
+	ctx, c, clctn := testSongs(t)
+
+	cur, err := clctn.Indexes().List(ctx)
+	if err != nil {
+		t.Fatalf("listing indices: %v", err)
+	}
+
+	var idxs []bson.M
+	if err := cur.All(ctx, &idxs); err != nil {
+		t.Fatalf("reading indices: %v", err)
+	}
+
+	// the defined indices and the builtin _id index
+	if len(idxs) != len(songsIndices)+1 {
+		t.Errorf("found %d indices, want %d", len(idxs), len(songsIndices)+1)
+	}
+
+	// the validator rejects a song of the wrong shape
+	if _, err := clctn.InsertOne(ctx, bson.M{"id": 1, "title": 1985, "artist": "Anon Artist"}); err == nil {
+		t.Errorf("validator accepted a numeric title")
+	}
+
+	// running the setup again leaves the collection as it is
+	ensureSongsCollection(ctx, c, clctn.Name())
+	ensureSongsIndices(ctx, c, clctn.Name())
+}
+
+func TestIntegrationProtectedImport(t *testing.T) {
+	ctx, _, clctn := testSongs(t)
+	withPolicies(t, nil, "title")
+
+	importTestSongs(t, ctx, clctn, "catalog.csv", testSong("49375", "Original"))
+	importTestSongs(t, ctx, clctn, "catalog.csv", testSong("49375", "Renamed"))
+
+	// the ID keeps its numeric type, so the second import matched the song
+	n, err := clctn.CountDocuments(ctx, bson.M{"id": bson.M{"$type": "int"}})
+	if err != nil {
+		t.Fatalf("counting songs: %v", err)
+	}
+
+	if tot, _ := clctn.CountDocuments(ctx, bson.D{}); n != 1 || tot != 1 {
+		t.Errorf("found %d songs with numeric IDs of %d, want 1 of 1", n, tot)
+	}
+
+	var sng Song
+	if err := clctn.FindOne(ctx, bson.M{"id": SongID("49375")}).Decode(&sng); err != nil {
+		t.Fatalf("finding song: %v", err)
+	}
+
+	if sng.Title != "Original" {
+		t.Errorf("protected title = %q, want %q", sng.Title, "Original")
+	}
+}
+
+func TestIntegrationStatuses(t *testing.T) {
+	ctx, _, clctn := testSongs(t)
+
+	importTestSongs(t, ctx, clctn, "catalog.csv", testSong("1", "One"), testSong("2", "Two"))
+	importTestSongs(t, ctx, clctn, "sheet", testSong("3", "Three"))
+
+	// a later import of the catalog without song 2
+	sourceName = "catalog.csv"
+	updateStatuses(ctx, clctn, []Song{testSong("1", "One")})
+
+	want := map[SongID]string{"1": statusActive, "2": statusUnavailable, "3": ""}
+	for id, st := range want {
+		var doc songDocument
+		if err := clctn.FindOne(ctx, bson.M{"id": id}).Decode(&doc); err != nil {
+			t.Fatalf("finding song %s: %v", id, err)
+		}
+
+		if doc.Status != st {
+			t.Errorf("song %s status = %q, want %q", id, doc.Status, st)
+		}
+	}
+
+	// supplementary imports never prune
+	supplementary = true
+	t.Cleanup(func() { supplementary = false })
+
+	sourceName = "sheet"
+	updateStatuses(ctx, clctn, []Song{})
+
+	var doc songDocument
+	if err := clctn.FindOne(ctx, bson.M{"id": SongID("3")}).Decode(&doc); err != nil {
+		t.Fatalf("finding song 3: %v", err)
+	}
+
+	if doc.Status == statusUnavailable {
+		t.Errorf("supplementary import marked song 3 unavailable")
+	}
+}
+
+func TestIntegrationMergeTakeTitle(t *testing.T) {
+	ctx, c, clctn := testSongs(t)
+
+	// the canonical song takes the title of a duplicate that shares its
+	// artist and year, so the two briefly share the unique key
+	dup, cnl := testSong("104233", "Bohemian Rhapsody"), testSong("6534", "Bohemian Rhapsody (Live)")
+	importTestSongs(t, ctx, clctn, "catalog.csv", dup, cnl)
+
+	rclctn := c.Database(karaokeDB).Collection(redirectsCollection)
+	t.Cleanup(func() { rclctn.DeleteMany(context.Background(), bson.M{"from": dup.ID}) })
+
+	tkn, err := mergeDuplicate(ctx, c, clctn.Name(), dup.ID, cnl.ID, []string{"title"})
+	if err != nil {
+		t.Fatalf("mergeDuplicate: %v", err)
+	}
+
+	if len(tkn) != 1 || tkn[0] != "title" {
+		t.Errorf("took %q, want title", tkn)
+	}
+
+	var sng Song
+	if err := clctn.FindOne(ctx, bson.M{"id": cnl.ID}).Decode(&sng); err != nil {
+		t.Fatalf("finding song %s: %v", cnl.ID, err)
+	}
+
+	if sng.Title != dup.Title {
+		t.Errorf("merged title = %q, want %q", sng.Title, dup.Title)
+	}
+
+	if n, _ := clctn.CountDocuments(ctx, bson.M{"id": dup.ID}); n != 0 {
+		t.Errorf("duplicate %s was not removed", dup.ID)
+	}
+
+	var rdr songRedirect
+	if err := rclctn.FindOne(ctx, bson.M{"from": dup.ID}).Decode(&rdr); err != nil {
+		t.Fatalf("finding redirect: %v", err)
+	}
+
+	if rdr.To != cnl.ID {
+		t.Errorf("redirect leads to %s, want %s", rdr.To, cnl.ID)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	karafunAttempts  = 3
+	karafunUserAgent = "karaoke-fun (+https://github.com/brozeph/karaoke-fun)"
+)
+
+var (
+	forceImport    bool
+	karafunTimeout = providerTimeout("KARAFUN", 2*time.Minute)
+	karafunURL     string
+	// songLink is the template of the KaraFun link to each song, with {id}
+	// replaced by the song's ID; empty disables links
+	songLink = "https://www.karafun.com/karaoke/song/{id}/"
+)
+
+// karafunSource downloads the live catalog from KaraFun in the same layout
+// as the CSV export, skipping the download when it has not changed since the
+// last import from the same url
+type karafunSource struct {
+	url string
+	// the validators of the last import and of this download
+	prior        importRun
+	etag         string
+	lastModified string
+	rcrds        [][]string
+}
+
+func (s *karafunSource) String() string {
+	return s.url
+}
+
+// fetch downloads the catalog unless the server reports it unchanged since
+// the prior import, backing off politely when asked to slow down
+func (s *karafunSource) fetch(ctx context.Context) (bool, error) {
+	for att := 1; ; att++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("User-Agent", karafunUserAgent)
+		if s.prior.ETag != "" {
+			req.Header.Set("If-None-Match", s.prior.ETag)
+		}
+		if s.prior.LastModified != "" {
+			req.Header.Set("If-Modified-Since", s.prior.LastModified)
+		}
+
+		res, err := httpClient.Do(req)
+		if err != nil {
+			return false, err
+		}
+
+		switch res.StatusCode {
+		case http.StatusOK:
+			defer res.Body.Close()
+
+			if s.rcrds, err = readCSV(res.Body); err != nil {
+				return false, err
+			}
+
+			s.etag, s.lastModified = res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+			return true, nil
+		case http.StatusNotModified:
+			res.Body.Close()
+			s.etag, s.lastModified = s.prior.ETag, s.prior.LastModified
+			return false, nil
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			res.Body.Close()
+			if att == karafunAttempts {
+				return false, fmt.Errorf("unexpected response from KaraFun: %s", res.Status)
+			}
+
+			// honor the requested delay, otherwise back off exponentially
+			d := time.Duration(1<<att) * 5 * time.Second
+			if secs, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+				d = time.Duration(secs) * time.Second
+			}
+
+			fmt.Printf("KaraFun asked to slow down (%s), retrying in %s\n", res.Status, d)
+			if err := sleep(ctx, d); err != nil {
+				return false, err
+			}
+		default:
+			res.Body.Close()
+			return false, fmt.Errorf("unexpected response from KaraFun: %s", res.Status)
+		}
+	}
+}
+
+// changed reports whether the catalog differs from the one the prior import
+// read, judged by the server's validators and then by the records' hash
+func (s *karafunSource) changed() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), karafunTimeout)
+	defer cancel()
+
+	mod, err := s.fetch(ctx)
+	if err != nil || !mod {
+		return false, err
+	}
+
+	return s.prior.SourceHash == "" || recordsHash(s.rcrds) != s.prior.SourceHash, nil
+}
+
+func (s *karafunSource) Records() ([][]string, error) {
+	if s.rcrds == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), karafunTimeout)
+		defer cancel()
+
+		if _, err := s.fetch(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.rcrds, nil
+}
+
+// karafunLink returns the link that opens a song in KaraFun, or nothing for
+// songs that are not from the KaraFun catalog, whose IDs are numeric
+func karafunLink(id SongID) string {
+	if _, ok := id.number(); !ok || songLink == "" {
+		return ""
+	}
+
+	return strings.ReplaceAll(songLink, "{id}", string(id))
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	filterExpired   bool
+	licenseWarnDays = 30
+	licensesPath    string
+)
+
+// license is the subscription a catalog source is provided under
+type license struct {
+	Source   string
+	Provider string
+	Expires  time.Time
+}
+
+// readLicenses reads a CSV of catalog sources (as named in the import log,
+// e.g. karafun.csv), their providers, and the dates their licenses expire
+func readLicenses(path string) []license {
+	lf, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Error opening file (%s): %v", path, err)
+		panic(exitError{exitSource, err})
+	}
+	defer lf.Close()
+
+	rdr := csv.NewReader(lf)
+	rdr.Comma = ';'
+	rdr.FieldsPerRecord = -1
+
+	rcrds, err := rdr.ReadAll()
+	if err != nil {
+		fmt.Printf("Error parsing CSV file (%s): %v", path, err)
+		panic(exitError{exitSource, err})
+	}
+
+	var lics []license
+	for i, rcrd := range rcrds {
+		// skip the header
+		if i == 0 {
+			continue
+		}
+
+		if len(rcrd) < 3 {
+			err := fmt.Errorf("row %d: expected source, provider, and expiry", i)
+			fmt.Printf("Error parsing CSV file (%s): %v", path, err)
+			panic(exitError{exitSource, err})
+		}
+
+		exp, ok := parseDate(rcrd[2])
+		if !ok {
+			err := fmt.Errorf("row %d: invalid expiry (%s)", i, rcrd[2])
+			fmt.Printf("Error parsing CSV file (%s): %v", path, err)
+			panic(exitError{exitSource, err})
+		}
+
+		// licenses lapse as the expiry date starts in the local time zone
+		lics = append(lics, license{
+			Source:   strings.TrimSpace(rcrd[0]),
+			Provider: strings.TrimSpace(rcrd[1]),
+			Expires:  startOfDay(exp),
+		})
+	}
+
+	return lics
+}
+
+// licenseWarning is a license that has expired or expires soon, as given
+// to the licenses.warning notification template
+type licenseWarning struct {
+	license
+	Days    int
+	Expired bool
+}
+
+func (w licenseWarning) String() string {
+	d := w.Expires.Format("2006-01-02")
+	if w.Expired {
+		return fmt.Sprintf("the %s license for %s expired on %s", w.Provider, w.Source, d)
+	}
+
+	return fmt.Sprintf("the %s license for %s expires in %d days on %s", w.Provider, w.Source, w.Days, d)
+}
+
+// expired reports whether the license has lapsed
+func (l license) expired(now time.Time) bool {
+	return !now.Before(l.Expires)
+}
+
+// checkLicenses warns about licenses that have expired or expire within the
+// warning window, posting the warnings to the configured Slack channels, and
+// returns the sources whose licenses have expired
+func checkLicenses(ctx context.Context, lics []license) map[string]bool {
+	now := time.Now()
+	wrn := now.AddDate(0, 0, licenseWarnDays)
+
+	exp := map[string]bool{}
+	var wrns []licenseWarning
+	for _, l := range lics {
+		switch {
+		case l.expired(now):
+			exp[l.Source] = true
+			wrns = append(wrns, licenseWarning{license: l, Expired: true})
+		case wrn.After(l.Expires):
+			wrns = append(wrns, licenseWarning{license: l, Days: int(l.Expires.Sub(now).Hours()/24) + 1})
+		}
+	}
+
+	if len(wrns) == 0 {
+		return exp
+	}
+
+	// a banner so the warning stands out in the import output
+	bnr := strings.Repeat("!", 72)
+	fmt.Println(bnr)
+	for _, w := range wrns {
+		fmt.Printf("Warning: %s\n", w)
+	}
+	fmt.Println(bnr)
+
+	if len(notifySlack) == 0 {
+		return exp
+	}
+
+	txt, err := renderNotification("licenses.warning", map[string]any{"Warnings": wrns})
+	if err != nil {
+		fmt.Printf("Error formatting license warning: %v\n", err)
+		return exp
+	}
+
+	nctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	for _, u := range notifySlack {
+		if err := postJSON(nctx, u, "", map[string]string{"text": txt}); err != nil {
+			fmt.Printf("Error sending license warning to Slack: %v\n", err)
+		}
+	}
+
+	return exp
+}
+
+// withdrawExpired marks the active songs last imported from sources whose
+// licenses have expired as unavailable
+func withdrawExpired(ctx context.Context, exp map[string]bool) {
+	if len(exp) == 0 {
+		return
+	}
+
+	srcs := make([]string, 0, len(exp))
+	for s := range exp {
+		srcs = append(srcs, s)
+	}
+
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	res, err := c.Database(karaokeDB).Collection(songsCollection).UpdateMany(
+		ctx,
+		bson.M{"source": bson.M{"$in": srcs}, "status": statusActive},
+		bson.M{"$set": bson.M{"status": statusUnavailable, "statusChangedAt": time.Now().UTC()}})
+	if err != nil {
+		fmt.Printf("Error withdrawing songs from expired sources: %v", err)
+		panic(err)
+	}
+
+	fmt.Printf("Withdrew %d songs from sources with expired licenses\n", res.ModifiedCount)
+}
+
+func runLicenses(args []string) int {
+	fs := flag.NewFlagSet("licenses", flag.ExitOnError)
+	fs.StringVar(&licensesPath, "licenses-file", "", "`path` to a CSV of catalog sources, their providers, and license expiry dates")
+	fs.IntVar(&licenseWarnDays, "warn-days", licenseWarnDays, "warn about licenses expiring within this many `days`")
+	fs.BoolVar(&filterExpired, "filter-expired", false, "mark songs from sources with expired licenses as unavailable")
+	fs.Func("notify-slack", "post license warnings to this Slack incoming webhook `url`; may be repeated", func(v string) error {
+		notifySlack = append(notifySlack, v)
+		return nil
+	})
+	fs.StringVar(&notifyTemplatePath, "notify-template", notifyTemplatePath, "`path` to a text/template file redefining the notification messages (defaults to KARAOKE_NOTIFY_TEMPLATE)")
+	fs.Parse(args)
+
+	if licensesPath == "" {
+		fmt.Println("Error: -licenses-file is required")
+		fs.Usage()
+		return exitConfig
+	}
+
+	if err := loadNotifyTemplates(); err != nil {
+		fmt.Printf("Error: invalid notification templates: %v\n", err)
+		fs.Usage()
+		return exitConfig
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	exp := checkLicenses(ctx, readLicenses(licensesPath))
+	if filterExpired {
+		withdrawExpired(ctx, exp)
+	}
+
+	// fail scheduled checks while any license has lapsed
+	if len(exp) > 0 {
+		return exitFailure
+	}
+
+	fmt.Println("Licenses checked")
+	return exitOK
+}
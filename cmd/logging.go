@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// logHeader starts every log file, recording when it was started since
+	// the modification time changes with every write
+	logHeader     = "# log started at "
+	logTimeFormat = "20060102T150405"
+)
+
+var (
+	logDone chan struct{}
+	// logFile is a file the output of every command is also written to,
+	// rotated by size and age
+	logFile = os.Getenv("KARAOKE_LOG_FILE")
+	// logKeep is the number of rotated log files retained
+	logKeep = envInt("KARAOKE_LOG_KEEP", 5)
+	// logMaxAge is the number of hours before the log file is rotated
+	logMaxAge = envInt("KARAOKE_LOG_MAX_AGE", 24)
+	// logMaxSize is the size in megabytes the log file is rotated at
+	logMaxSize = envInt("KARAOKE_LOG_MAX_SIZE", 10)
+	logPipe    *os.File
+	logStdout  *os.File
+	// logSyslog is the tag output is also sent to syslog (and journald) with
+	logSyslog = os.Getenv("KARAOKE_LOG_SYSLOG")
+)
+
+// envInt returns an environment variable as an integer, or the default when
+// it is unset or invalid
+func envInt(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return n
+	}
+
+	return def
+}
+
+// rotatingFile is a log file that is renamed with a timestamp suffix and
+// replaced once it reaches a maximum size or age
+type rotatingFile struct {
+	f       *os.File
+	hdr     int64
+	keep    int
+	maxAge  time.Duration
+	maxSize int64
+	opened  time.Time
+	path    string
+	size    int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, keep int) (*rotatingFile, error) {
+	rf := &rotatingFile{keep: keep, maxAge: maxAge, maxSize: maxSize, path: path}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	rf.f, rf.hdr, rf.size = f, 0, fi.Size()
+	if rf.size > 0 {
+		rf.opened = logStarted(rf.path)
+		return nil
+	}
+
+	// age is measured from when the file was first written
+	rf.opened = time.Now()
+	n, err := fmt.Fprintf(f, "%s%s\n", logHeader, rf.opened.UTC().Format(time.RFC3339))
+	rf.hdr, rf.size = int64(n), int64(n)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return nil
+}
+
+// logStarted returns when a log file was started from its header; files
+// without one are treated as expired so they are rotated on the next write
+func logStarted(path string) time.Time {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}
+	}
+	defer f.Close()
+
+	ln, _ := bufio.NewReader(f).ReadString('\n')
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(strings.TrimPrefix(ln, logHeader)))
+	if !strings.HasPrefix(ln, logHeader) || err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	exp := rf.maxAge > 0 && time.Since(rf.opened) > rf.maxAge
+	// a file holding only its header is not rotated again
+	if rf.size > rf.hdr && (exp || (rf.maxSize > 0 && rf.size+int64(len(p)) > rf.maxSize)) {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file and removes rotated files beyond keep
+func (rf *rotatingFile) rotate() error {
+	rf.f.Close()
+
+	if err := os.Rename(rf.path, rf.path+"."+time.Now().Format(logTimeFormat)); err != nil {
+		return err
+	}
+
+	if rtd, err := filepath.Glob(rf.path + ".*"); err == nil && rf.keep > 0 && len(rtd) > rf.keep {
+		sort.Strings(rtd)
+		for _, p := range rtd[:len(rtd)-rf.keep] {
+			os.Remove(p)
+		}
+	}
+
+	return rf.open()
+}
+
+func (rf *rotatingFile) Close() error {
+	return rf.f.Close()
+}
+
+// startLogging copies everything commands print to the configured log file
+// and syslog in addition to stdout
+func startLogging() {
+	if logFile == "" && logSyslog == "" {
+		return
+	}
+
+	var snks []io.Writer
+	var errs []io.Writer
+	if logFile != "" {
+		rf, err := openRotatingFile(logFile, int64(logMaxSize)<<20, time.Duration(logMaxAge)*time.Hour, logKeep)
+		if err != nil {
+			fmt.Printf("Error opening log file (%s): %v\n", logFile, err)
+			os.Exit(exitConfig)
+		}
+
+		snks = append(snks, rf)
+		errs = append(errs, rf)
+	}
+
+	if logSyslog != "" {
+		info, errw, err := openSyslog(logSyslog)
+		if err != nil {
+			fmt.Printf("Error connecting to syslog: %v\n", err)
+			os.Exit(exitConfig)
+		}
+
+		snks = append(snks, info)
+		errs = append(errs, errw)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		fmt.Printf("Error redirecting output for logging: %v\n", err)
+		os.Exit(exitFailure)
+	}
+
+	logStdout, logPipe, logDone = os.Stdout, w, make(chan struct{})
+	os.Stdout = w
+
+	// forward output line by line so each line is logged at its severity
+	go func() {
+		defer close(logDone)
+
+		br := bufio.NewReader(r)
+		for {
+			ln, err := br.ReadString('\n')
+			if ln != "" {
+				logStdout.WriteString(ln)
+
+				ws := snks
+				if strings.HasPrefix(ln, "Error") {
+					ws = errs
+				}
+
+				for _, w := range ws {
+					w.Write([]byte(ln))
+				}
+			}
+
+			if err != nil {
+				break
+			}
+		}
+
+		for _, w := range snks {
+			if c, ok := w.(io.Closer); ok {
+				c.Close()
+			}
+		}
+	}()
+}
+
+// stopLogging flushes output to the log sinks and restores stdout
+func stopLogging() {
+	if logPipe == nil {
+		return
+	}
+
+	os.Stdout = logStdout
+	logPipe.Close()
+	<-logDone
+	logPipe = nil
+}
+
+// commandStdout returns the stdout commands write their data to, which is
+// not copied to the log sinks
+func commandStdout() *os.File {
+	if logPipe != nil {
+		return logStdout
+	}
+
+	return os.Stdout
+}
+
+// exit stops logging and exits with the code
+func exit(code int) {
+	stopLogging()
+	os.Exit(code)
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+// openSyslog is unsupported where the standard library has no syslog client
+func openSyslog(tag string) (io.Writer, io.Writer, error) {
+	return nil, nil, errors.New("syslog is not supported on this platform")
+}
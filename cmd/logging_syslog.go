@@ -0,0 +1,28 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// syslogErrors writes to syslog at the error severity
+type syslogErrors struct {
+	w *syslog.Writer
+}
+
+func (se syslogErrors) Write(p []byte) (int, error) {
+	return len(p), se.w.Err(string(p))
+}
+
+// openSyslog connects to the local syslog daemon (or journald), returning
+// writers for informational and error output
+func openSyslog(tag string) (io.Writer, io.Writer, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return w, syslogErrors{w}, nil
+}
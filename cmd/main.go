@@ -2,10 +2,10 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
 	"fmt"
 	"os"
-	"strconv"
+	"reflect"
+	"sort"
 	"strings"
 	"time"
 
@@ -16,124 +16,64 @@ import (
 )
 
 const (
-	karaokeDB              = "karaoke-db"
-	karaokeFilePath string = "./data/karafuncatalog.csv"
-	mongoTimeout           = 30 * time.Second
-	mongoURI               = "mongodb://localhost:27017"
-	songsCollection        = "songs"
+	disconnectTimeout           = 10 * time.Second
+	importRunsCollection        = "import_runs"
+	karaokeDB                   = "karaoke-db"
+	karaokeFilePath      string = "./data/karafuncatalog.csv"
+	mongoTimeout                = 30 * time.Second
+	mongoURI                    = "mongodb://localhost:27017"
+	redirectsCollection         = "song_redirects"
+	snapshotsCollection         = "song_snapshots"
+	songsCollection             = "songs"
+	stagingCollection           = "songs_staging"
+	syncStateCollection         = "sync_state"
 )
 
 var (
-	songsIndices = []mongo.IndexModel{
-		{
-			Keys: bson.D{primitive.E{
-				Key:   "id",
-				Value: 1,
-			}},
-			Options: &options.IndexOptions{
-				Unique: &unique,
-			},
-		},
-		{
-			Keys: bson.D{
-				primitive.E{
-					Key:   "title",
-					Value: 1,
-				},
-				primitive.E{
-					Key:   "artist",
-					Value: 1,
-				},
-				primitive.E{
-					Key:   "year",
-					Value: 1,
-				},
-			},
-			Options: &options.IndexOptions{
-				Unique: &unique,
-			},
-		},
-		{
-			Keys: bson.D{
-				primitive.E{
-					Key:   "title",
-					Value: 1,
-				},
-			},
-		},
-		{
-			Keys: bson.D{
-				primitive.E{
-					Key:   "artist",
-					Value: 1,
-				},
-			},
-		},
+	// commands are the subcommands available alongside the default import
+	commands = map[string]func(args []string) int{
+		"advisory":        runAdvisory,
+		"difficulty":      runDifficulty,
+		"embed":           runEmbed,
+		"export":          runExport,
+		"get":             runGet,
+		"import":          runImport,
+		"licenses":        runLicenses,
+		"merge":           runMerge,
+		"preview":         runPreview,
+		"publish":         runPublish,
+		"schema":          runSchema,
+		"semantic-search": runSemanticSearch,
+		"snapshots":       runSnapshots,
+		"sources":         runSources,
+		"stats":           runStats,
+		"status":          runStatus,
+		"tags":            runTags,
 	}
-	songsSchema bson.M = bson.M{
-		"bsonType": "object",
-		"required": []string{"id", "title", "artist"},
-		"properties": bson.M{
-			"id": bson.M{
-				"bsonType":    "int",
-				"description": "the unique identifier for a song in karafun catalog",
-			},
-			"title": bson.M{
-				"bsonType":    "string",
-				"description": "the title of the song",
-			},
-			"artist": bson.M{
-				"bsonType":    "string",
-				"description": "the artist of the song",
-			},
-			"year": bson.M{
-				"bsonType":    "int",
-				"description": "the year the song was released",
-			},
-			"duo": bson.M{
-				"bsonType":    "bool",
-				"description": "whether the song is a duet",
-			},
-			"explicit": bson.M{
-				"bsonType":    "bool",
-				"description": "whether the song is explicit",
-			},
-			"dateAdded": bson.M{
-				"bsonType":    "date",
-				"description": "the date the song was added to the catalog",
-			},
-			"styles": bson.M{
-				"bsonType":    "array",
-				"description": "the styles of the song",
-				"items": bson.M{
-					"bsonType": "string",
-				},
-			},
-			"languages": bson.M{
-				"bsonType":    "array",
-				"description": "the languages of the song",
-				"items": bson.M{
-					"bsonType": "string",
-				},
-			},
-		},
-	}
-	unique bool = true
+	// csvHeader is the header row of the KaraFun export
+	csvHeader = []string{"Id", "Title", "Artist", "Year", "Duo", "Explicit", "Date Added", "Styles", "Languages"}
+	// songsIndices are the indices of the songs collection, from the
+	// definitions file
+	songsIndices []mongo.IndexModel
+	// songsSchema is the $jsonSchema validator generated from songDocument
+	songsSchema bson.M = documentSchema(reflect.TypeOf(songDocument{}), "")
 )
 
 type Song struct {
-	ID        int       `bson:"id"`        // 0
-	Title     string    `bson:"title"`     // 1
-	Artist    string    `bson:"artist"`    // 2
-	Year      int       `bson:"year"`      // 3
-	Duo       bool      `bson:"duo"`       // 4
-	Explicit  bool      `bson:"explicit"`  // 5
-	DateAdded time.Time `bson:"dateAdded"` // 6
-	Styles    []string  `bson:"styles"`    // 7
-	Languages []string  `bson:"languages"` // 8
+	ID        SongID     `bson:"id" json:"id" schema:"required" description:"the unique identifier for a song in the provider catalog (numeric, alphanumeric, or a UUID)"` // 0
+	Title     string     `bson:"title" json:"title" schema:"required" description:"the title of the song"`                                                                 // 1
+	Artist    string     `bson:"artist" json:"artist" schema:"required" description:"the artist of the song"`                                                              // 2
+	Year      int        `bson:"year" json:"year" description:"the year the song was released"`                                                                            // 3
+	Duo       bool       `bson:"duo" json:"duo" description:"whether the song is a duet"`                                                                                  // 4
+	Explicit  bool       `bson:"explicit" json:"explicit" description:"whether the song is explicit"`                                                                      // 5
+	DateAdded time.Time  `bson:"dateAdded" json:"dateAdded" description:"the date the song was added to the catalog"`                                                      // 6
+	Styles    []Style    `bson:"styles" json:"styles" description:"the styles of the song"`                                                                                // 7
+	Languages []Language `bson:"languages" json:"languages" description:"the languages of the song"`                                                                       // 8
+	Regions   []string   `bson:"regions" json:"regions" description:"the regions the song is licensed in (empty when licensed everywhere)"`
+	Mood      string     `bson:"mood" json:"mood" description:"the mood classified from the song's styles (empty when unclassified)"`
 }
 
-func ensureSongsCollection(ctx context.Context, c *mongo.Client) {
+func ensureSongsCollection(ctx context.Context, c *mongo.Client, name string) {
 	// retrieve collections from db
 	clcts, err := c.Database(karaokeDB).ListCollectionNames(ctx, bson.D{{}})
 	if err != nil {
@@ -143,9 +83,9 @@ func ensureSongsCollection(ctx context.Context, c *mongo.Client) {
 
 	// check if collection exists
 	for _, clct := range clcts {
-		if clct == "songs" {
+		if clct == name {
 			// make sure the schema is up-to-date
-			ensureSongsSchema(ctx, c)
+			ensureSongsSchema(ctx, c, name)
 			return
 		}
 	}
@@ -154,16 +94,16 @@ func ensureSongsCollection(ctx context.Context, c *mongo.Client) {
 	if err := c.Database(karaokeDB).
 		CreateCollection(
 			ctx,
-			"songs",
-			options.CreateCollection().SetValidator(bson.M{
-				"$jsonSchema": songsSchema,
-			})); err != nil {
+			name,
+			options.CreateCollection().
+				SetValidator(bson.M{"$jsonSchema": validatorSchema()}).
+				SetValidationAction(validationAction())); err != nil {
 		fmt.Printf("Error creating collection: %v", err)
 		panic(err)
 	}
 }
 
-func ensureSongsIndices(ctx context.Context, c *mongo.Client) {
+func ensureSongsIndices(ctx context.Context, c *mongo.Client, name string) {
 	// create a map with index names
 	sim := make(map[string]mongo.IndexModel, len(songsIndices))
 
@@ -191,7 +131,7 @@ func ensureSongsIndices(ctx context.Context, c *mongo.Client) {
 	}
 
 	// retrieve existing indices from db
-	mi := c.Database(karaokeDB).Collection(songsCollection).Indexes()
+	mi := c.Database(karaokeDB).Collection(name).Indexes()
 	cur, err := mi.List(ctx)
 	if err != nil {
 		fmt.Printf("Error retrieving existing indices: %v", err)
@@ -229,23 +169,27 @@ func ensureSongsIndices(ctx context.Context, c *mongo.Client) {
 	}
 }
 
-func ensureSongsSchema(ctx context.Context, c *mongo.Client) {
+func ensureSongsSchema(ctx context.Context, c *mongo.Client, name string) {
 	cmd := bson.D{
 		primitive.E{
 			Key:   "collMod",
-			Value: songsCollection,
+			Value: name,
 		},
 		primitive.E{
 			Key: "validator",
 			Value: bson.D{primitive.E{
 				Key:   "$jsonSchema",
-				Value: songsSchema,
+				Value: validatorSchema(),
 			}},
 		},
 		primitive.E{
 			Key:   "validationLevel",
 			Value: "moderate",
 		},
+		primitive.E{
+			Key:   "validationAction",
+			Value: validationAction(),
+		},
 	}
 
 	if err := c.Database(karaokeDB).RunCommand(ctx, cmd).Err(); err != nil {
@@ -254,117 +198,85 @@ func ensureSongsSchema(ctx context.Context, c *mongo.Client) {
 	}
 }
 
-func readSongs() []Song {
-	// read the CSV cf
-	cf, err := os.Open(karaokeFilePath)
+func readSongs(src source) []Song {
+	// read the raw records, header first
+	rcrds, err := src.Records()
 	if err != nil {
-		fmt.Printf("Error opening file (%s): %v", karaokeFilePath, err)
-		panic(err)
+		fmt.Printf("Error reading source (%s): %v", src, err)
+		panic(exitError{exitSource, err})
 	}
-	defer cf.Close()
 
-	// create a new CSV reader
-	rdr := csv.NewReader(cf)
-	rdr.Comma = ';'
-
-	// parse the CSV
-	rcrds, err := rdr.ReadAll()
-	if err != nil {
-		fmt.Printf("Error parsing CSV file (%s): %v", karaokeFilePath, err)
-		panic(err)
+	if len(rcrds) == 0 {
+		err := fmt.Errorf("no header record")
+		fmt.Printf("Error reading source (%s): %v", src, err)
+		panic(exitError{exitSource, err})
 	}
 
-	// create a slice of songs
-	sngs := make([]Song, 0, len(rcrds)-1)
-	for i, rcrd := range rcrds {
-		if i == 0 {
-			continue
-		}
-
-		sng := Song{
-			Title:  rcrd[1],
-			Artist: rcrd[2],
-		}
+	// identify the records so songs can be traced back to them
+	sourceHash, sourceName = recordsHash(rcrds), src.String()
 
-		// parse the id
-		if id, err := strconv.Atoi(rcrd[0]); err == nil {
-			sng.ID = id
-		}
+	// allow hooks to fix up or filter the raw records, which keep the lines
+	// they were read from
+	srs := runRecordHooks(rcrds[0], sourceRecords(rcrds[1:]))
 
-		// parse the year
-		if yr, err := strconv.Atoi(rcrd[3]); err == nil {
-			sng.Year = yr
-		}
+	// parse the records into songs across workers
+	sngs := parseSongs(srs)
 
-		// parse the duo
-		if duo, err := strconv.ParseBool(rcrd[4]); err == nil {
-			sng.Duo = duo
-		}
+	// allow hooks to transform or filter the parsed songs
+	sngs = runSongHooks(hookTransform, sngs)
 
-		// parse the explicit
-		if expl, err := strconv.ParseBool(rcrd[5]); err == nil {
-			sng.Explicit = expl
-		}
+	// apply licensing regions and drop songs unavailable in this deployment
+	sngs = applyRegions(sngs)
 
-		// parse the date added
-		if da, err := time.Parse("2006-01-02", rcrd[6]); err == nil {
-			sng.DateAdded = da
-		}
+	// order by ID so the import (and anything derived from it) is repeatable
+	sort.SliceStable(sngs, func(i, j int) bool {
+		return sngs[i].ID.Less(sngs[j].ID)
+	})
 
-		// parse the styles
-		sng.Styles = strings.Split(rcrd[7], ",")
+	return sngs
+}
 
-		// parse the languages
-		sng.Languages = strings.Split(rcrd[8], ",")
+// connectMongo connects to MongoDB and verifies the server is reachable
+func connectMongo(ctx context.Context) *mongo.Client {
+	c, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI).SetRegistry(songsRegistry).SetMonitor(chaosMonitor()))
+	if err != nil {
+		fmt.Printf("Error connecting to MongoDB (%s): %v", mongoURI, err)
+		panic(exitError{exitConfig, err})
+	}
 
-		// add the song
-		sngs = append(sngs, sng)
+	if err := c.Ping(ctx, nil); err != nil {
+		fmt.Printf("Error reaching MongoDB (%s): %v", mongoURI, err)
+		panic(exitError{exitDatabase, err})
 	}
 
-	return sngs
+	return c
 }
 
-func main() {
-	// read the songs
-	sngs := readSongs()
-
-	// connect to the database
-	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+// disconnectMongo allows in-flight operations a bounded amount of time to
+// complete before closing the client
+func disconnectMongo(c *mongo.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
 	defer cancel()
 
-	c, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
-	if err != nil {
-		fmt.Printf("Error connecting to MongoDB (%s): %v", mongoURI, err)
-		panic(err)
+	if err := c.Disconnect(ctx); err != nil {
+		fmt.Printf("Error disconnecting from MongoDB (%s): %v\n", mongoURI, err)
 	}
+}
 
-	// ensure the collection is created with indices as appropriate
-	ensureSongsCollection(ctx, c)
-	ensureSongsIndices(ctx, c)
-
-	// insert all of the songs into MongoDB
-	clctn := c.Database(karaokeDB).Collection(songsCollection)
-	n := 0
-	for _, sng := range sngs {
-		fmt.Printf("Upserting song (%d): \"%s\" by %s\n", sng.ID, sng.Title, sng.Artist)
-
-		err := clctn.FindOneAndUpdate(
-			ctx,
-			bson.M{"id": sng.ID},
-			bson.M{"$set": sng},
-			options.FindOneAndUpdate().SetUpsert(true)).Err()
+func main() {
+	startLogging()
+	defer exitOnPanic()
 
-		// track newly inserted songs
-		if err == mongo.ErrNoDocuments {
-			n++
-			continue
-		}
+	loadDefinitions()
+	loadTimeZone()
+	startChaos()
 
-		if err != nil {
-			fmt.Printf("Error inserting song (%d): %v", sng.ID, err)
-			panic(err)
+	// run a subcommand when one is named, otherwise import the catalog
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			exit(cmd(os.Args[2:]))
 		}
 	}
 
-	fmt.Printf("Import complete: inserted %d songs and updated %d songs!\n", n, (len(sngs) - n))
+	exit(runImport(os.Args[1:]))
 }
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// songRedirect records that a duplicate song was merged into another so
+// references to the merged ID can be resolved and imports skip it
+type songRedirect struct {
+	From     SongID    `bson:"from"`
+	To       SongID    `bson:"to"`
+	MergedAt time.Time `bson:"mergedAt"`
+}
+
+// emptyValue reports whether a stored value is missing or holds nothing, so
+// the merged song's value can fill it
+func emptyValue(v any) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		return rv.Len() == 0
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Float64:
+		return rv.IsZero()
+	}
+
+	return false
+}
+
+// mergeSongs combines a duplicate into the canonical song: the fields in
+// take come from the duplicate, empty fields are filled from it, and tags
+// are combined; it returns the fields taken from the duplicate
+func mergeSongs(into bson.M, from bson.M, take []string) []string {
+	var tkn []string
+	for k, v := range from {
+		switch {
+		case k == "_id" || k == "id":
+			continue
+		case k == "tags":
+			tgs, _ := into["tags"].(bson.A)
+			has := map[any]bool{}
+			for _, t := range tgs {
+				has[t] = true
+			}
+
+			add, _ := v.(bson.A)
+			for _, t := range add {
+				if !has[t] {
+					tgs = append(tgs, t)
+					has[t] = true
+				}
+			}
+
+			if len(tgs) > 0 {
+				into["tags"] = tgs
+			}
+			continue
+		}
+
+		tk := emptyValue(into[k]) && !emptyValue(v)
+		for _, f := range take {
+			tk = tk || f == k
+		}
+
+		if tk {
+			into[k] = v
+			tkn = append(tkn, k)
+		}
+	}
+
+	return tkn
+}
+
+// redirectedSongs returns the IDs of merged songs and the songs they were
+// merged into
+func redirectedSongs(ctx context.Context, c *mongo.Client) map[SongID]SongID {
+	cur, err := c.Database(karaokeDB).Collection(redirectsCollection).Find(ctx, bson.D{})
+	if err != nil {
+		fmt.Printf("Error retrieving song redirects: %v", err)
+		panic(err)
+	}
+
+	var rdrs []songRedirect
+	if err = cur.All(ctx, &rdrs); err != nil {
+		fmt.Printf("Error reading song redirects: %v", err)
+		panic(err)
+	}
+
+	m := make(map[SongID]SongID, len(rdrs))
+	for _, r := range rdrs {
+		m[r.From] = r.To
+	}
+
+	return m
+}
+
+// skipMerged removes songs that were merged into another song, so imports
+// do not bring the duplicates back
+func skipMerged(ctx context.Context, c *mongo.Client, sngs []Song) []Song {
+	rdrs := redirectedSongs(ctx, c)
+	if len(rdrs) == 0 {
+		return sngs
+	}
+
+	msngs := sngs[:0]
+	for _, sng := range sngs {
+		if to, ok := rdrs[sng.ID]; ok {
+			fmt.Printf("Skipping song (%s): merged into %s\n", sng.ID, to)
+			continue
+		}
+
+		msngs = append(msngs, sng)
+	}
+
+	summary.Skipped += len(sngs) - len(msngs)
+	return msngs
+}
+
+// mergeDuplicate merges the duplicate song into the canonical song of the
+// collection and records the redirect, returning the fields taken from the
+// duplicate; the writes share a transaction, so the duplicate is removed
+// before the canonical song takes its title, artist, or year without the
+// unique key colliding, and a failure part way leaves both songs
+func mergeDuplicate(ctx context.Context, c *mongo.Client, name string, fid SongID, iid SongID, take []string) ([]string, error) {
+	db := c.Database(karaokeDB)
+	clctn := db.Collection(name)
+	rclctn := db.Collection(redirectsCollection)
+
+	// indices can not be created in a transaction
+	if _, err := rclctn.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{primitive.E{Key: "from", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}); err != nil {
+		return nil, fmt.Errorf("creating index on %s: %w", redirectsCollection, err)
+	}
+
+	sess, err := c.StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer sess.EndSession(ctx)
+
+	tkn, err := sess.WithTransaction(ctx, func(sctx mongo.SessionContext) (any, error) {
+		sngs := map[SongID]bson.M{}
+		for _, id := range []SongID{fid, iid} {
+			var doc bson.M
+			if err := clctn.FindOne(sctx, bson.M{"id": id}).Decode(&doc); err != nil {
+				return nil, fmt.Errorf("retrieving song (%s): %w", id, err)
+			}
+
+			sngs[id] = doc
+		}
+
+		doc := sngs[iid]
+		tkn := mergeSongs(doc, sngs[fid], take)
+
+		if _, err := clctn.DeleteOne(sctx, bson.M{"id": fid}); err != nil {
+			return nil, fmt.Errorf("removing song (%s): %w", fid, err)
+		}
+
+		if _, err := clctn.ReplaceOne(sctx, bson.M{"_id": doc["_id"]}, doc); err != nil {
+			return nil, fmt.Errorf("updating song (%s): %w", iid, err)
+		}
+
+		// songs merged into the duplicate earlier now lead to the canonical
+		// song
+		if _, err := rclctn.UpdateMany(sctx, bson.M{"to": fid}, bson.M{"$set": bson.M{"to": iid}}); err != nil {
+			return nil, fmt.Errorf("rewriting song redirects (%s): %w", fid, err)
+		}
+
+		if _, err := rclctn.ReplaceOne(
+			sctx,
+			bson.M{"from": fid},
+			songRedirect{From: fid, To: iid, MergedAt: time.Now().UTC()},
+			options.Replace().SetUpsert(true)); err != nil {
+			return nil, fmt.Errorf("recording song redirect (%s): %w", fid, err)
+		}
+
+		return tkn, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tkn.([]string), nil
+}
+
+func runMerge(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	from := fs.String("from", "", "`id` of the duplicate song to merge and remove")
+	into := fs.String("into", "", "`id` of the canonical song to keep")
+	take := fs.String("take", "", "comma separated `fields` to take from the duplicate instead of the canonical song")
+	fs.Parse(args)
+
+	fid, ferr := parseSongID(*from)
+	iid, ierr := parseSongID(*into)
+	if ferr != nil || ierr != nil || fid == iid {
+		fmt.Println("Error: -from and -into must be two different song ids")
+		fs.Usage()
+		return exitConfig
+	}
+
+	flds := splitList(*take)
+	props := songsSchema["properties"].(bson.M)
+	for _, f := range flds {
+		if _, ok := props[f]; !ok || f == "id" {
+			fmt.Printf("Error: unknown field to take: %s\n", f)
+			fs.Usage()
+			return exitConfig
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	tkn, err := mergeDuplicate(ctx, c, songsCollection, fid, iid, flds)
+	if err != nil {
+		fmt.Printf("Error merging song (%s) into song (%s): %v", fid, iid, err)
+		panic(err)
+	}
+
+	took := "nothing"
+	if len(tkn) > 0 {
+		sort.Strings(tkn)
+		took = strings.Join(tkn, ", ")
+	}
+	fmt.Printf("Merged song (%s) into song (%s), taking %s\n", fid, iid, took)
+
+	return exitOK
+}
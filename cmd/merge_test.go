@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMergeSongs(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		into bson.M
+		from bson.M
+		take []string
+		want bson.M
+		tkn  []string
+	}{
+		{
+			name: "canonical fields are kept",
+			into: bson.M{"_id": 1, "id": int32(6534), "title": "Canonical", "year": int32(1975)},
+			from: bson.M{"_id": 2, "id": int32(104233), "title": "Duplicate", "year": int32(1976)},
+			want: bson.M{"_id": 1, "id": int32(6534), "title": "Canonical", "year": int32(1975)},
+		},
+		{
+			name: "taken fields",
+			into: bson.M{"id": int32(6534), "title": "Canonical", "year": int32(1975)},
+			from: bson.M{"id": int32(104233), "title": "Duplicate", "year": int32(1976)},
+			take: []string{"title"},
+			want: bson.M{"id": int32(6534), "title": "Duplicate", "year": int32(1975)},
+			tkn:  []string{"title"},
+		},
+		{
+			name: "empty fields are filled",
+			into: bson.M{"id": int32(6534), "title": "Canonical", "year": int32(0), "styles": bson.A{}},
+			from: bson.M{"id": int32(104233), "title": "Duplicate", "year": int32(1976), "styles": bson.A{"Rock"}},
+			want: bson.M{"id": int32(6534), "title": "Canonical", "year": int32(1976), "styles": bson.A{"Rock"}},
+			tkn:  []string{"styles", "year"},
+		},
+		{
+			name: "empty duplicate fields are not taken",
+			into: bson.M{"id": int32(6534), "year": int32(1975)},
+			from: bson.M{"id": int32(104233), "year": int32(0)},
+			want: bson.M{"id": int32(6534), "year": int32(1975)},
+		},
+		{
+			name: "tags are combined",
+			into: bson.M{"id": int32(6534), "tags": bson.A{"Holiday", "Duet"}},
+			from: bson.M{"id": int32(104233), "tags": bson.A{"Duet", "Classic"}},
+			want: bson.M{"id": int32(6534), "tags": bson.A{"Holiday", "Duet", "Classic"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tkn := mergeSongs(tc.into, tc.from, tc.take)
+			sort.Strings(tkn)
+
+			if !reflect.DeepEqual(tc.into, tc.want) {
+				t.Errorf("merged song = %v, want %v", tc.into, tc.want)
+			}
+
+			if !reflect.DeepEqual(tkn, tc.tkn) {
+				t.Errorf("took %q, want %q", tkn, tc.tkn)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+const (
+	moodChill     = "chill"
+	moodEmotional = "emotional"
+	moodHype      = "hype"
+	moodParty     = "party"
+)
+
+var (
+	// moods are the classifications a song can have, in tie-break order
+	moods = []string{moodParty, moodHype, moodEmotional, moodChill}
+	// styleMoods weights how strongly each provider style suggests a mood;
+	// broad styles such as Pop only nudge the classification
+	styleMoods = map[Style]map[string]float64{
+		"80s":                      {moodParty: 1},
+		"Alternative":              {moodHype: 1},
+		"Blues":                    {moodChill: 1},
+		"Celtic":                   {moodChill: 1},
+		"Christian":                {moodEmotional: 1},
+		"Christmas":                {moodParty: 0.5, moodChill: 0.5},
+		"Classical":                {moodChill: 1},
+		"Country":                  {moodChill: 0.5, moodParty: 0.5},
+		"Dance":                    {moodParty: 2},
+		"Disco":                    {moodParty: 2},
+		"Electro":                  {moodParty: 1, moodHype: 1},
+		"Folk":                     {moodChill: 1},
+		"French pop":               {moodEmotional: 0.5},
+		"Funk":                     {moodParty: 1.5},
+		"Gospel":                   {moodEmotional: 1},
+		"Hard/Metal":               {moodHype: 2},
+		"Humor":                    {moodParty: 1},
+		"Jazz":                     {moodChill: 1.5},
+		"Kids":                     {moodParty: 0.5},
+		"Latin Music":              {moodParty: 1.5},
+		"Love":                     {moodEmotional: 2},
+		"Musette":                  {moodChill: 1},
+		"Musical":                  {moodEmotional: 1},
+		"Oriental":                 {moodChill: 0.5},
+		"Pop":                      {moodParty: 0.5},
+		"Punk/Grunge":              {moodHype: 2},
+		"R&B":                      {moodEmotional: 1},
+		"Rap":                      {moodHype: 1.5},
+		"Reggae":                   {moodChill: 1},
+		"Rock":                     {moodHype: 1},
+		"Rock 'n Roll":             {moodParty: 1.5},
+		"Schlager":                 {moodParty: 1.5},
+		"Ska":                      {moodParty: 1},
+		"Soft rock":                {moodChill: 1},
+		"Soul":                     {moodEmotional: 1},
+		"TV & movie soundtrack":    {moodEmotional: 0.5},
+		"Teen pop":                 {moodParty: 1},
+		"Traditionnal":             {moodChill: 0.5},
+		"World/Folk":               {moodChill: 1},
+		"Zouk/Creole/Soca/Calypso": {moodParty: 2},
+	}
+)
+
+// classifyMood returns the mood most strongly suggested by a song's styles,
+// or an empty string when none of its styles suggest one
+func classifyMood(sng Song) string {
+	scrs := make(map[string]float64, len(moods))
+	for _, st := range sng.Styles {
+		for m, w := range styleMoods[st] {
+			scrs[m] += w
+		}
+	}
+
+	mood, best := "", 0.0
+	for _, m := range moods {
+		if scrs[m] > best {
+			mood, best = m, scrs[m]
+		}
+	}
+
+	return mood
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/brozeph/karaoke-fun/webhook"
+)
+
+const (
+	// announceGroups and announceSongs cap the style and artist groups of an
+	// announcement and the songs listed in each, so the first import into an
+	// empty catalog does not post the whole catalog
+	announceGroups = 10
+	announceSongs  = 5
+)
+
+var (
+	notifySlack    []string
+	notifyTimeout  = providerTimeout("NOTIFY", 10*time.Second)
+	notifyWebhooks []webhookEndpoint
+)
+
+// webhookEndpoint is a webhook and the secret its deliveries are signed
+// with, when it has one
+type webhookEndpoint struct {
+	URL    string
+	Secret string
+}
+
+// newSong is the subset of a song announced to webhooks
+type newSong struct {
+	ID     SongID `json:"id"`
+	Title  string `json:"title"`
+	Artist string `json:"artist"`
+	Year   int    `json:"year,omitempty"`
+	Link   string `json:"link,omitempty"`
+}
+
+// songGroup is a named group of new songs, such as a style or an artist;
+// Count is the size of the group, of which at most announceSongs are listed
+type songGroup struct {
+	Name  string    `json:"name"`
+	Count int       `json:"count"`
+	Songs []newSong `json:"songs"`
+}
+
+// newSongsPayload announces the songs added to the catalog by an import,
+// grouped by primary style and by artist, with text ready for social posts;
+// the largest groups are listed and the rest counted
+type newSongsPayload struct {
+	Event       string      `json:"event"`
+	Count       int         `json:"count"`
+	Styles      []songGroup `json:"styles"`
+	MoreStyles  int         `json:"moreStyles"`
+	Artists     []songGroup `json:"artists"`
+	MoreArtists int         `json:"moreArtists"`
+	Text        string      `json:"text"`
+}
+
+// groupSongs groups songs by key, largest groups first, listing the first
+// announceSongs songs of each
+func groupSongs(sngs []Song, key func(Song) string) []songGroup {
+	idx := map[string]int{}
+	grps := []songGroup{}
+	for _, sng := range sngs {
+		k := key(sng)
+		i, ok := idx[k]
+		if !ok {
+			i = len(grps)
+			idx[k] = i
+			grps = append(grps, songGroup{Name: k})
+		}
+
+		grps[i].Count++
+		if len(grps[i].Songs) == announceSongs {
+			continue
+		}
+
+		grps[i].Songs = append(grps[i].Songs, newSong{
+			ID:     sng.ID,
+			Title:  sng.Title,
+			Artist: sng.Artist,
+			Year:   sng.Year,
+			Link:   karafunLink(sng.ID),
+		})
+	}
+
+	sort.SliceStable(grps, func(i, j int) bool {
+		if grps[i].Count != grps[j].Count {
+			return grps[i].Count > grps[j].Count
+		}
+
+		return grps[i].Name < grps[j].Name
+	})
+
+	return grps
+}
+
+// topGroups returns the largest groups, at most announceGroups, and the
+// number left out
+func topGroups(grps []songGroup) ([]songGroup, int) {
+	if len(grps) <= announceGroups {
+		return grps, 0
+	}
+
+	return grps[:announceGroups], len(grps) - announceGroups
+}
+
+// newSongsAnnouncement returns the announcement of the songs added by an
+// import, without its text
+func newSongsAnnouncement(sngs []Song) newSongsPayload {
+	pld := newSongsPayload{Event: "songs.added", Count: len(sngs)}
+	pld.Styles, pld.MoreStyles = topGroups(groupSongs(sngs, primaryStyle))
+	pld.Artists, pld.MoreArtists = topGroups(groupSongs(sngs, func(sng Song) string { return sng.Artist }))
+
+	return pld
+}
+
+// primaryStyle is the first style listed for a song
+func primaryStyle(sng Song) string {
+	if len(sng.Styles) == 0 {
+		return "Other"
+	}
+
+	return string(sng.Styles[0])
+}
+
+// postJSON posts a JSON body to a webhook, signing it when there is a secret
+func postJSON(ctx context.Context, url string, secret string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(webhook.SignatureHeader, webhook.Sign([]byte(secret), time.Now(), b))
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response from webhook: %s", res.Status)
+	}
+
+	return nil
+}
+
+// notifyNewSongs announces the songs added by an import to the configured
+// webhooks and Slack channels; failures are printed and otherwise ignored
+func notifyNewSongs(ctx context.Context, sngs []Song) {
+	if len(sngs) == 0 || len(notifyWebhooks)+len(notifySlack) == 0 {
+		return
+	}
+
+	pld := newSongsAnnouncement(sngs)
+
+	// the text is ready for copy-paste into posts
+	var err error
+	if pld.Text, err = renderNotification(pld.Event, pld); err != nil {
+		fmt.Printf("Error formatting new songs announcement: %v\n", err)
+		return
+	}
+
+	nctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	for _, ep := range notifyWebhooks {
+		if err := postJSON(nctx, ep.URL, ep.Secret, pld); err != nil {
+			fmt.Printf("Error sending new songs webhook (%s): %v\n", ep.URL, err)
+		}
+	}
+
+	// Slack incoming webhooks only accept a message
+	for _, u := range notifySlack {
+		if err := postJSON(nctx, u, "", map[string]string{"text": pld.Text}); err != nil {
+			fmt.Printf("Error sending new songs to Slack: %v\n", err)
+		}
+	}
+
+	fmt.Printf("Announced %d new songs\n", len(sngs))
+}
+
+// addWebhook adds a webhook, signed with KARAOKE_WEBHOOK_SECRET until a
+// -notify-secret is given for it
+func addWebhook(url string) error {
+	notifyWebhooks = append(notifyWebhooks, webhookEndpoint{URL: url, Secret: os.Getenv("KARAOKE_WEBHOOK_SECRET")})
+	return nil
+}
+
+// setWebhookSecret sets the secret of the webhook added last
+func setWebhookSecret(secret string) error {
+	if len(notifyWebhooks) == 0 {
+		return fmt.Errorf("must follow the -notify-webhook it signs")
+	}
+
+	notifyWebhooks[len(notifyWebhooks)-1].Secret = secret
+	return nil
+}
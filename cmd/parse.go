@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// timeZone is the IANA time zone the days named in commands and files
+	// start and end in; timestamps are always stored in UTC
+	timeZone = time.UTC
+	// dateFormats are tried in order when parsing the date added
+	dateFormats = []string{
+		"2006-01-02",
+		"02/01/2006",
+		"02.01.2006",
+		"2006/01/02",
+		"02-01-2006",
+	}
+	// falseValues are the normalized (lower case) values parsed as false
+	falseValues = map[string]bool{
+		"0":     true,
+		"f":     true,
+		"false": true,
+		"n":     true,
+		"no":    true,
+		"non":   true,
+		"nein":  true,
+		"nee":   true,
+	}
+	// trueValues are the normalized (lower case) values parsed as true
+	trueValues = map[string]bool{
+		"1":    true,
+		"t":    true,
+		"true": true,
+		"y":    true,
+		"yes":  true,
+		"oui":  true,
+		"ja":   true,
+		"si":   true,
+		"sí":   true,
+	}
+)
+
+// addBoolValues adds comma separated values to the set of accepted values
+func addBoolValues(vals map[string]bool, csv string) {
+	for _, v := range strings.Split(csv, ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			vals[v] = true
+		}
+	}
+}
+
+// formatBool formats a boolean the way the KaraFun export does
+func formatBool(b bool) string {
+	if b {
+		return "1"
+	}
+
+	return "0"
+}
+
+// parseBool parses the boolean variants found in locale specific exports
+func parseBool(s string) (bool, bool) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	if trueValues[v] {
+		return true, true
+	}
+
+	if falseValues[v] {
+		return false, true
+	}
+
+	return false, false
+}
+
+// parseDate parses a date using the first of the configured formats that
+// matches the value
+func parseDate(s string) (time.Time, bool) {
+	v := strings.TrimSpace(s)
+	for _, f := range dateFormats {
+		if d, err := time.Parse(f, v); err == nil {
+			return d, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// startOfDay returns midnight of the date in the configured time zone
+func startOfDay(d time.Time) time.Time {
+	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, timeZone)
+}
+
+// loadTimeZone sets the time zone from KARAOKE_TIME_ZONE, when set
+func loadTimeZone() {
+	tz := os.Getenv("KARAOKE_TIME_ZONE")
+	if tz == "" {
+		return
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		fmt.Printf("Error loading time zone (%s): %v", tz, err)
+		panic(exitError{exitConfig, err})
+	}
+
+	timeZone = loc
+}
+
+// setDateFormats replaces the date formats with comma separated Go layouts,
+// keeping them when no layout is given
+func setDateFormats(csv string) error {
+	var fmts []string
+	for _, f := range strings.Split(csv, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fmts = append(fmts, f)
+		}
+	}
+
+	if len(fmts) == 0 {
+		return fmt.Errorf("at least one date layout is required")
+	}
+
+	dateFormats = fmts
+	return nil
+}
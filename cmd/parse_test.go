@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseGolden is the outcome of parsing a fixture, compared with its golden
+// file
+type parseGolden struct {
+	Header []string     `json:"header"`
+	Songs  []parsedSong `json:"songs"`
+	Errors []string     `json:"errors"`
+}
+
+// parsedSong is a parsed song and the source line it was traced to
+type parsedSong struct {
+	Line int  `json:"line"`
+	Song Song `json:"song"`
+}
+
+// resetImport clears the import state parsing records into
+func resetImport(t *testing.T) {
+	t.Helper()
+
+	summary = importSummary{Changes: []songChanges{}, Errors: []string{}}
+	sourceLines = map[SongID]int{}
+	t.Cleanup(func() {
+		summary = importSummary{Changes: []songChanges{}, Errors: []string{}}
+		sourceLines = map[SongID]int{}
+	})
+}
+
+func TestParseFixtures(t *testing.T) {
+	fxs, err := filepath.Glob(filepath.Join("testdata", "*.csv"))
+	if err != nil || len(fxs) == 0 {
+		t.Fatalf("no fixtures found: %v", err)
+	}
+
+	for _, fx := range fxs {
+		t.Run(filepath.Base(fx), func(t *testing.T) {
+			resetImport(t)
+
+			rcrds, err := csvSource{path: fx}.Records()
+			if err != nil {
+				t.Fatalf("reading %s: %v", fx, err)
+			}
+
+			res := parseGolden{Header: rcrds[0], Songs: []parsedSong{}}
+			for _, sng := range parseSongs(sourceRecords(rcrds[1:])) {
+				res.Songs = append(res.Songs, parsedSong{sourceLines[sng.ID], sng})
+			}
+			res.Errors = summary.Errors
+
+			got, err := json.MarshalIndent(res, "", "  ")
+			if err != nil {
+				t.Fatalf("encoding result: %v", err)
+			}
+			got = append(got, '\n')
+
+			gld := strings.TrimSuffix(fx, ".csv") + ".golden.json"
+			if *updateGolden {
+				if err := os.WriteFile(gld, got, 0644); err != nil {
+					t.Fatalf("writing %s: %v", gld, err)
+				}
+			}
+
+			want, err := os.ReadFile(gld)
+			if err != nil {
+				t.Fatalf("reading %s: %v", gld, err)
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Errorf("parsing %s differs from %s; review the change and rerun with -update\ngot:\n%s", fx, gld, got)
+			}
+		})
+	}
+}
+
+func TestParseFixturesHeader(t *testing.T) {
+	for _, fx := range []string{"bom.csv", "quoting.csv"} {
+		rcrds, err := csvSource{path: filepath.Join("testdata", fx)}.Records()
+		if err != nil {
+			t.Fatalf("reading %s: %v", fx, err)
+		}
+
+		if !reflect.DeepEqual(rcrds[0], csvHeader) {
+			t.Errorf("%s header = %q, want %q", fx, rcrds[0], csvHeader)
+		}
+	}
+}
+
+func TestParseRecord(t *testing.T) {
+	rcrd := func(s string) []string {
+		return strings.Split(s, ";")
+	}
+
+	for _, tc := range []struct {
+		name string
+		rcrd []string
+		want Song
+		err  string
+	}{
+		{
+			name: "full",
+			rcrd: rcrd("73087;Take On Me;a-ha;1985;0;0;2019-03-14;Pop,Synthpop;English"),
+			want: Song{ID: "73087", Title: "Take On Me", Artist: "a-ha", Year: 1985, DateAdded: time.Date(2019, 3, 14, 0, 0, 0, 0, time.UTC), Styles: []Style{"Pop", "Synthpop"}, Languages: []Language{"English"}},
+		},
+		{
+			name: "booleans",
+			rcrd: rcrd("1;Duet;Anon;;Oui;yes;;;"),
+			want: Song{ID: "1", Title: "Duet", Artist: "Anon", Duo: true, Explicit: true, Styles: []Style{}, Languages: []Language{}},
+		},
+		{
+			name: "unparsed values are left unset",
+			rcrd: rcrd("1;Odd;Anon;1985a;maybe;2;14 March 2019;;"),
+			want: Song{ID: "1", Title: "Odd", Artist: "Anon", Styles: []Style{}, Languages: []Language{}},
+		},
+		{
+			name: "uuid is lower cased",
+			rcrd: rcrd("0F8FAD5B-D9CB-469F-A165-70867728950E;Song;Anon;;;;;;"),
+			want: Song{ID: "0f8fad5b-d9cb-469f-a165-70867728950e", Title: "Song", Artist: "Anon", Styles: []Style{}, Languages: []Language{}},
+		},
+		{
+			name: "id is trimmed",
+			rcrd: rcrd(" 42 ;Song;Anon;;;;;;"),
+			want: Song{ID: "42", Title: "Song", Artist: "Anon", Styles: []Style{}, Languages: []Language{}},
+		},
+		{
+			name: "empty id",
+			rcrd: rcrd(";Song;Anon;;;;;;"),
+			err:  `invalid id () for "Song" by Anon`,
+		},
+		{
+			name: "short record",
+			rcrd: rcrd("1;Song;Anon"),
+			err:  "expected 9 fields, found 3",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseRecord(tc.rcrd)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("parseRecord error = %v, want %s", err, tc.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseRecord: %v", err)
+			}
+
+			tc.want.Regions = []string{}
+			tc.want.Mood = classifyMood(tc.want)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseRecord = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseSongsOrder(t *testing.T) {
+	resetImport(t)
+
+	// more records than workers, with invalid records spread through them
+	var rcrds [][]string
+	for i := 0; i < 10*parseWorkers+7; i++ {
+		id := ""
+		if i%3 != 0 {
+			id = string(rune('a'+i%26)) + strings.Repeat("x", i)
+		}
+
+		rcrds = append(rcrds, []string{id, "Song", "Anon", "", "", "", "", "", ""})
+	}
+
+	sngs := parseSongs(sourceRecords(rcrds))
+	for i, sng := range sngs {
+		if ln := sourceLines[sng.ID]; i > 0 && ln <= sourceLines[sngs[i-1].ID] {
+			t.Fatalf("song %d (%s) at line %d is out of order", i, sng.ID, ln)
+		}
+	}
+
+	for i, e := range summary.Errors {
+		if want := "row " + strconv.Itoa(3*i+1) + ":"; !strings.HasPrefix(e, want) {
+			t.Fatalf("error %d = %s, want it to start with %s", i, e, want)
+		}
+	}
+}
+
+func TestRecordHooksKeepLines(t *testing.T) {
+	resetImport(t)
+
+	// drop the first record and add one of its own
+	recordHooks[hookPreValidate] = []recordHook{func(krs []map[string]string) ([]map[string]string, error) {
+		return append(krs[1:], map[string]string{"Id": "", "Title": "Added", "Artist": "Hook"}), nil
+	}}
+	t.Cleanup(func() { delete(recordHooks, hookPreValidate) })
+
+	rcrds := [][]string{
+		{"1", "First", "Anon", "", "", "", "", "", ""},
+		{"", "Second", "Anon", "", "", "", "", "", ""},
+		{"3", "Third", "Anon", "", "", "", "", "", ""},
+	}
+
+	sngs := parseSongs(runRecordHooks(csvHeader, sourceRecords(rcrds)))
+	if len(sngs) != 1 || sourceLines[sngs[0].ID] != 4 {
+		t.Errorf("songs = %+v at lines %v, want song 3 at line 4", sngs, sourceLines)
+	}
+
+	want := []string{`row 2: invalid id () for "Second" by Anon`, `record 3 (added by a hook): invalid id () for "Added" by Hook`}
+	if !reflect.DeepEqual(summary.Errors, want) {
+		t.Errorf("errors = %q, want %q", summary.Errors, want)
+	}
+}
+
+func TestSetDateFormats(t *testing.T) {
+	def := dateFormats
+	t.Cleanup(func() { dateFormats = def })
+
+	if err := setDateFormats(" 02/01/2006 , ,2006-01-02"); err != nil {
+		t.Fatalf("setDateFormats: %v", err)
+	}
+
+	if want := []string{"02/01/2006", "2006-01-02"}; !reflect.DeepEqual(dateFormats, want) {
+		t.Errorf("dateFormats = %q, want %q", dateFormats, want)
+	}
+
+	if d, ok := parseDate("14/03/2019"); !ok || !d.Equal(time.Date(2019, 3, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseDate(14/03/2019) = %s, %t, want 2019-03-14", d, ok)
+	}
+
+	// no layouts leave the formats as they were
+	for _, v := range []string{"", " , ,"} {
+		if err := setDateFormats(v); err == nil {
+			t.Errorf("setDateFormats(%q) accepted", v)
+		}
+	}
+
+	if len(dateFormats) != 2 {
+		t.Errorf("dateFormats = %q after rejected layouts, want them kept", dateFormats)
+	}
+}
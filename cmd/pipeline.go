@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+)
+
+// parseWorkers is the number of goroutines parsing records concurrently
+var parseWorkers = runtime.NumCPU()
+
+// sourceRecord is a raw record and the line of the source it was read from,
+// 0 for records added by hooks
+type sourceRecord struct {
+	line   int
+	fields []string
+}
+
+// parsedRecord is the outcome of parsing the record at a position
+type parsedRecord struct {
+	i   int
+	sng Song
+	err error
+}
+
+// sourceRecords numbers the records following the header, which is line 1
+func sourceRecords(rcrds [][]string) []sourceRecord {
+	srs := make([]sourceRecord, 0, len(rcrds))
+	for i, rcrd := range rcrds {
+		srs = append(srs, sourceRecord{line: i + 2, fields: rcrd})
+	}
+
+	return srs
+}
+
+// parseRecord parses a record in the KaraFun export layout into a song
+func parseRecord(rcrd []string) (Song, error) {
+	if len(rcrd) < len(csvHeader) {
+		return Song{}, fmt.Errorf("expected %d fields, found %d", len(csvHeader), len(rcrd))
+	}
+
+	sng := Song{
+		Title:   rcrd[1],
+		Artist:  rcrd[2],
+		Regions: []string{},
+	}
+
+	// parse the id, skipping songs that can not be identified
+	id, err := parseSongID(rcrd[0])
+	if err != nil {
+		return sng, fmt.Errorf("invalid id (%s) for \"%s\" by %s", rcrd[0], sng.Title, sng.Artist)
+	}
+	sng.ID = id
+
+	// parse the year
+	if yr, err := strconv.Atoi(rcrd[3]); err == nil {
+		sng.Year = yr
+	}
+
+	// parse the duo
+	if duo, ok := parseBool(rcrd[4]); ok {
+		sng.Duo = duo
+	}
+
+	// parse the explicit
+	if expl, ok := parseBool(rcrd[5]); ok {
+		sng.Explicit = expl
+	}
+
+	// parse the date added
+	if da, ok := parseDate(rcrd[6]); ok {
+		sng.DateAdded = da
+	}
+
+	// parse the styles
+	sng.Styles = parseStyles(rcrd[7])
+
+	// parse the languages
+	sng.Languages = parseLanguages(rcrd[8])
+
+	// classify the mood from the styles
+	sng.Mood = classifyMood(sng)
+
+	return sng, nil
+}
+
+// parseSongs parses records concurrently through bounded channels, keeping
+// the songs in record order; invalid records are reported in row order,
+// where the first row after the header is row 1
+//
+// only the parsing runs in parallel: the records are read whole beforehand,
+// since the source hash and pre-validate hooks cover every record, and the
+// songs are collected, since imports sort them by ID and prune the songs
+// missing from them
+func parseSongs(rcrds []sourceRecord) []Song {
+	in := make(chan int, parseWorkers)
+	out := make(chan parsedRecord, parseWorkers)
+
+	for w := 0; w < parseWorkers; w++ {
+		go func() {
+			for i := range in {
+				sng, err := parseRecord(rcrds[i].fields)
+				out <- parsedRecord{i: i, sng: sng, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		for i := range rcrds {
+			in <- i
+		}
+		close(in)
+	}()
+
+	// hold results that finish early until the records before them are
+	// done, so the outcome does not depend on which worker finished first
+	sngs := make([]Song, 0, len(rcrds))
+	pnd := make(map[int]parsedRecord, parseWorkers)
+	for nxt := 0; nxt < len(rcrds); {
+		pr := <-out
+		pnd[pr.i] = pr
+
+		for r, ok := pnd[nxt]; ok; r, ok = pnd[nxt] {
+			delete(pnd, nxt)
+			nxt++
+
+			ln := rcrds[r.i].line
+			if r.err != nil {
+				if ln == 0 {
+					summary.skip("record %d (added by a hook): %v", r.i+1, r.err)
+				} else {
+					summary.skip("row %d: %v", ln-1, r.err)
+				}
+
+				continue
+			}
+
+			sourceLines[r.sng.ID] = ln
+			sngs = append(sngs, r.sng)
+		}
+	}
+
+	return sngs
+}
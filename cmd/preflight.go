@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// indexEntryBytes approximates the size of one index entry when there
+	// is no existing catalog to measure
+	indexEntryBytes = 40
+	// preflightSample is the number of songs encoded to estimate their size
+	preflightSample = 1000
+)
+
+var (
+	preflight      bool
+	storageLimitMB float64
+)
+
+// collectionStats are the sizes reported by collStats, in bytes
+type collectionStats struct {
+	Count          int64 `bson:"count"`
+	Size           int64 `bson:"size"`
+	StorageSize    int64 `bson:"storageSize"`
+	TotalIndexSize int64 `bson:"totalIndexSize"`
+}
+
+// songsStats returns the size of the live catalog, or zeros when the
+// collection does not exist yet
+func songsStats(ctx context.Context, c *mongo.Client) collectionStats {
+	cmd := bson.D{
+		primitive.E{
+			Key:   "collStats",
+			Value: songsCollection,
+		},
+	}
+
+	var st collectionStats
+	if err := c.Database(karaokeDB).RunCommand(ctx, cmd).Decode(&st); err != nil {
+		return collectionStats{}
+	}
+
+	return st
+}
+
+// megabytes formats a size in bytes as megabytes
+func megabytes(b float64) string {
+	return fmt.Sprintf("%.1f MB", b/(1<<20))
+}
+
+// preflightEstimate prints the documents an import would add and the
+// storage and index growth they are likely to cause, estimated from the
+// encoded size of a sample of songs and the current index size per song
+func preflightEstimate(ctx context.Context, c *mongo.Client, sngs []Song) {
+	lids := liveSongIDs(ctx, c)
+
+	var add []Song
+	for _, sng := range sngs {
+		if !lids[sng.ID] {
+			add = append(add, sng)
+		}
+	}
+
+	// sample evenly across the new songs, or the whole import when none
+	smp := add
+	if len(smp) == 0 {
+		smp = sngs
+	}
+
+	var smpBytes, smpN int
+	stp := len(smp)/preflightSample + 1
+	for i := 0; i < len(smp); i += stp {
+		b, err := bson.MarshalWithRegistry(songsRegistry, smp[i])
+		if err != nil {
+			fmt.Printf("Error encoding song (%s): %v", smp[i].ID, err)
+			panic(err)
+		}
+
+		smpBytes += len(b)
+		smpN++
+	}
+
+	avg := 0.0
+	if smpN > 0 {
+		avg = float64(smpBytes) / float64(smpN)
+	}
+
+	st := songsStats(ctx, c)
+	idxPer := float64((len(songsIndices) + 1) * indexEntryBytes)
+	if st.Count > 0 {
+		idxPer = float64(st.TotalIndexSize) / float64(st.Count)
+	}
+
+	dataGrowth := avg * float64(len(add))
+	idxGrowth := idxPer * float64(len(add))
+	total := float64(st.StorageSize+st.TotalIndexSize) + dataGrowth + idxGrowth
+
+	fmt.Printf("Pre-flight estimate for %d songs:\n", len(sngs))
+	fmt.Printf("  current catalog: %d songs, %s data, %s storage, %s indices\n",
+		st.Count, megabytes(float64(st.Size)), megabytes(float64(st.StorageSize)), megabytes(float64(st.TotalIndexSize)))
+	fmt.Printf("  new songs: %d (%d already in the catalog)\n", len(add), len(sngs)-len(add))
+	fmt.Printf("  average song size: %.0f bytes (sampled %d songs)\n", avg, smpN)
+	fmt.Printf("  data growth: ~%s\n", megabytes(dataGrowth))
+	fmt.Printf("  index growth: ~%s\n", megabytes(idxGrowth))
+	fmt.Printf("  projected total: ~%s\n", megabytes(total))
+
+	// a staged import briefly keeps a full second copy of the catalog
+	peak := total
+	if staging {
+		peak *= 2
+		fmt.Printf("  peak while staging: ~%s\n", megabytes(peak))
+	}
+
+	if storageLimitMB > 0 && peak > storageLimitMB*(1<<20) {
+		fmt.Printf("Warning: the import is likely to exceed the %.0f MB storage limit of the target cluster\n", storageLimitMB)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	itunesTimeout = providerTimeout("ITUNES", 10*time.Second)
+	// itunesSearchURL is the iTunes Search API endpoint previews are
+	// resolved from
+	itunesSearchURL = "https://itunes.apple.com/search"
+	// qualifiers are parenthesized or bracketed parts of titles, such as
+	// "(Remastered)" or "[Live]", ignored when matching
+	qualifiers = regexp.MustCompile(`\([^)]*\)|\[[^\]]*\]`)
+)
+
+// Preview is a short clip of the original recording of a song, so singers
+// can confirm the version before queueing it
+type Preview struct {
+	URL        string    `bson:"url" description:"the url of a 30 second clip of the song, empty when none was found"`
+	TrackURL   string    `bson:"trackUrl" description:"the url of the recording on the provider"`
+	Source     string    `bson:"source" description:"the provider the preview was resolved from"`
+	ResolvedAt time.Time `bson:"resolvedAt" description:"the date the preview was resolved"`
+}
+
+// matchKey reduces a title or artist to lowercase letters and digits,
+// without qualifiers, so minor differences in naming still match
+func matchKey(s string) string {
+	s = qualifiers.ReplaceAllString(strings.ToLower(s), "")
+
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// itunesPreview searches the iTunes store for the song and returns the
+// preview of the first track whose title and artist match, if any
+func itunesPreview(ctx context.Context, sng Song, country string) (Preview, error) {
+	q := url.Values{}
+	q.Set("term", sng.Artist+" "+qualifiers.ReplaceAllString(sng.Title, ""))
+	q.Set("country", country)
+	q.Set("media", "music")
+	q.Set("entity", "song")
+	q.Set("limit", "10")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, itunesSearchURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return Preview{}, err
+	}
+
+	res, err := enrichmentClient.Do(req)
+	if err != nil {
+		return Preview{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		return Preview{}, fmt.Errorf("%w by iTunes Search: %s", errRateLimited, res.Status)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return Preview{}, fmt.Errorf("unexpected response from iTunes Search: %s", res.Status)
+	}
+
+	var sr struct {
+		Results []struct {
+			ArtistName   string `json:"artistName"`
+			TrackName    string `json:"trackName"`
+			PreviewURL   string `json:"previewUrl"`
+			TrackViewURL string `json:"trackViewUrl"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&sr); err != nil {
+		return Preview{}, err
+	}
+
+	pv := Preview{Source: "itunes", ResolvedAt: time.Now().UTC()}
+	ttl, art := matchKey(sng.Title), matchKey(sng.Artist)
+	for _, r := range sr.Results {
+		// karaoke versions would not confirm the original recording
+		if r.PreviewURL == "" || strings.Contains(strings.ToLower(r.TrackName+r.ArtistName), "karaoke") {
+			continue
+		}
+
+		if matchKey(r.TrackName) == ttl && strings.Contains(matchKey(r.ArtistName), art) {
+			pv.URL, pv.TrackURL = r.PreviewURL, r.TrackViewURL
+			break
+		}
+	}
+
+	return pv, nil
+}
+
+func runPreview(args []string) int {
+	fs := flag.NewFlagSet("preview", flag.ExitOnError)
+	ids := fs.String("ids", "", "comma separated song `ids` to resolve previews for")
+	filter := fs.String("filter", "", "MongoDB query `filter` (extended JSON) selecting songs to resolve previews for")
+	q := fs.String("q", "", "`query` selecting songs to resolve previews for, e.g. artist:\"queen\" year:1975..1985")
+	all := fs.Bool("all", false, "re-resolve songs that already have a preview, not only new songs")
+	country := fs.String("country", "US", "the two letter `country` code of the iTunes store to search")
+	rpm := fs.Int("requests-per-minute", 20, "maximum iTunes Search requests per minute")
+	fs.StringVar(&itunesSearchURL, "itunes-url", itunesSearchURL, "`url` of the iTunes Search API")
+	sum := fs.String("summary-json", "", "write a JSON summary of the run to this `path` (- for stdout)")
+	fs.StringVar(&pushgatewayURL, "pushgateway", pushgatewayURL, "push the run's metrics to the Prometheus Pushgateway at this `url` when finished (defaults to KARAOKE_PUSHGATEWAY)")
+	fs.Parse(args)
+
+	if *rpm < 1 {
+		fmt.Println("Error: -requests-per-minute must be at least 1")
+		fs.Usage()
+		return exitConfig
+	}
+
+	qry := bson.M{}
+	if *ids != "" || *filter != "" || *q != "" {
+		var err error
+		if qry, err = songsFilter(*ids, *filter, *q); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			fs.Usage()
+			return exitConfig
+		}
+	}
+
+	if !*all {
+		qry = bson.M{"$and": bson.A{qry, bson.M{"preview": bson.M{"$exists": false}}}}
+	}
+
+	// resolving the whole catalog takes a while, so only bound each song
+	start := time.Now()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cctx, cancel := context.WithTimeout(ctx, mongoTimeout)
+	defer cancel()
+
+	c := connectMongo(cctx)
+	defer disconnectMongo(c)
+
+	clctn := c.Database(karaokeDB).Collection(songsCollection)
+	cur, err := clctn.Find(cctx, qry, options.Find().SetProjection(bson.M{"embedding": 0}).SetSort(bson.M{"id": 1}))
+	if err != nil {
+		fmt.Printf("Error retrieving songs: %v", err)
+		panic(err)
+	}
+
+	var sngs []Song
+	if err = cur.All(cctx, &sngs); err != nil {
+		fmt.Printf("Error reading songs: %v", err)
+		panic(err)
+	}
+
+	// skip songs while iTunes Search is failing; they are resolved next run
+	brk := newBreaker("iTunes Search")
+	thr := newThrottle(float64(*rpm) / 60)
+	n, f, e := 0, 0, 0
+	defer func() {
+		reportEnrichment("preview", *sum, enrichmentSummary{Enriched: n, Failed: e, Skipped: len(sngs) - n - e, Breaker: brk.report()}, start)
+	}()
+	for _, sng := range sngs {
+		ok, err := brk.wait(ctx)
+		if err == nil && ok {
+			err = thr.wait(ctx, 1)
+		}
+
+		if err != nil {
+			fmt.Printf("Preview resolution interrupted: resolved %d of %d songs\n", n, len(sngs))
+			return exitPartial
+		}
+
+		if !ok {
+			continue
+		}
+
+		ictx, icancel := context.WithTimeout(ctx, itunesTimeout)
+		pv, err := itunesPreview(ictx, sng, *country)
+		icancel()
+		if err != nil {
+			e++
+			brk.failure(err)
+			fmt.Printf("Error resolving preview (%s): %v\n", sng.ID, err)
+			continue
+		}
+		brk.success()
+
+		// songs without a match keep an empty preview so they are not
+		// searched for again unless re-resolved
+		sctx, scancel := context.WithTimeout(ctx, mongoTimeout)
+		_, err = clctn.UpdateOne(sctx, bson.M{"id": sng.ID}, bson.M{"$set": bson.M{"preview": pv}})
+		scancel()
+		if err != nil {
+			fmt.Printf("Error storing preview (%s): %v", sng.ID, err)
+			panic(err)
+		}
+
+		n++
+		if pv.URL != "" {
+			f++
+			fmt.Printf("Resolved preview (%s): \"%s\" by %s\n", sng.ID, sng.Title, sng.Artist)
+		}
+	}
+
+	fmt.Printf("Preview resolution complete: found previews for %d of %d songs\n", f, n)
+
+	if e+brk.skipped > 0 {
+		fmt.Printf("Preview resolution left %d songs unresolved (%d failed, %d skipped, %s)\n", e+brk.skipped, e, brk.skipped, brk)
+		return exitPartial
+	}
+
+	return exitOK
+}
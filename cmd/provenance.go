@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// importRunID identifies this import's record in the import runs
+	// collection and is stamped on every song it writes
+	importRunID = primitive.NewObjectID()
+	// sourceHash is the hash of the records read from the source
+	sourceHash string
+	// sourceLines are the lines of the source each song was parsed from
+	sourceLines = map[SongID]int{}
+	// sourceName names the source the songs were read from
+	sourceName string
+)
+
+// Provenance traces a stored song back to the import and source record that
+// last wrote it
+type Provenance struct {
+	ImportedAt  time.Time          `bson:"importedAt" description:"the date an import last wrote the song"`
+	ImportRunID primitive.ObjectID `bson:"importRunID" description:"the _id of the import run (in import_runs) that last wrote the song"`
+	Source      string             `bson:"source" description:"the source the song was imported from (a CSV path or sheet)"`
+	SourceHash  string             `bson:"sourceHash" description:"the SHA-256 of the source records the song was imported from"`
+	SourceLine  int                `bson:"sourceLine" description:"the line of the source the song was imported from (the header is line 1)"`
+	FieldHashes map[string]string  `bson:"fieldHashes" description:"the hashes of the values the provider last supplied for each imported field, to tell local edits apart"`
+}
+
+// importedSong is a song as written by an import
+type importedSong struct {
+	Song       `bson:",inline"`
+	Provenance `bson:",inline"`
+}
+
+// recordsHash returns the hex SHA-256 of raw records, so the same catalog
+// hashes the same whether it was read from a CSV or a sheet
+func recordsHash(rcrds [][]string) string {
+	h := sha256.New()
+	for _, rcrd := range rcrds {
+		h.Write([]byte(strings.Join(rcrd, "\x1f")))
+		h.Write([]byte{'\x1e'})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// provenanceOf returns the provenance of a song written by this import
+func provenanceOf(sng Song, at time.Time) Provenance {
+	return Provenance{
+		ImportedAt:  at.UTC(),
+		ImportRunID: importRunID,
+		Source:      sourceName,
+		SourceHash:  sourceHash,
+		SourceLine:  sourceLines[sng.ID],
+		FieldHashes: fieldHashes(sng),
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	//go:embed songbook.html
+	songbookHTML string
+	songbookPage = template.Must(template.New("songbook").Parse(songbookHTML))
+)
+
+// songbookSong is a song as listed in the published songbook, with the
+// lowercase text it is searched by
+type songbookSong struct {
+	ID        SongID     `json:"id"`
+	Title     string     `json:"title"`
+	Artist    string     `json:"artist"`
+	Year      int        `json:"year,omitempty"`
+	Duo       bool       `json:"duo,omitempty"`
+	Explicit  bool       `json:"explicit,omitempty"`
+	Styles    []Style    `json:"styles,omitempty"`
+	Languages []Language `json:"languages,omitempty"`
+	Link      string     `json:"link,omitempty"`
+	Initial   string     `json:"initial"`
+	Key       string     `json:"key"`
+}
+
+// initialCount is the number of songs in a jump bar bucket
+type initialCount struct {
+	Initial string `json:"initial"`
+	Count   int    `json:"count"`
+}
+
+// songbookInitials are the songs per artist and title initial, for the
+// alphabet jump bar
+type songbookInitials struct {
+	Artists []initialCount `json:"artists"`
+	Titles  []initialCount `json:"titles"`
+}
+
+// songbook is the search index loaded by the songbook page
+type songbook struct {
+	Generated time.Time        `json:"generated"`
+	Count     int              `json:"count"`
+	Initials  songbookInitials `json:"initials"`
+	Songs     []songbookSong   `json:"songs"`
+}
+
+// initialBuckets are the jump bar buckets in order: A to Z, digits, and
+// everything else
+var initialBuckets = append(strings.Split("ABCDEFGHIJKLMNOPQRSTUVWXYZ", ""), "0-9", "#")
+
+// initialFolds are the Latin letters without a decomposition that are listed
+// under another letter
+var initialFolds = map[rune]rune{'Æ': 'A', 'Đ': 'D', 'Ð': 'D', 'Ł': 'L', 'Œ': 'O', 'Ø': 'O', 'ß': 'S', 'Þ': 'T'}
+
+// initial returns the jump bar bucket of a name: its first letter with any
+// accents removed (É is listed under E), 0-9, or # for other scripts and
+// symbols; a leading "The" is skipped as it is when browsing a songbook
+func initial(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 4 && strings.EqualFold(s[:4], "the ") {
+		s = s[4:]
+	}
+
+	for _, r := range norm.NFD.String(s) {
+		if f, ok := initialFolds[unicode.ToUpper(r)]; ok {
+			r = f
+		} else if f, ok := initialFolds[r]; ok {
+			r = f
+		}
+
+		switch {
+		case unicode.Is(unicode.Mn, r), unicode.IsPunct(r), unicode.IsSpace(r):
+			continue
+		case r >= '0' && r <= '9':
+			return "0-9"
+		case unicode.ToUpper(r) >= 'A' && unicode.ToUpper(r) <= 'Z':
+			return string(unicode.ToUpper(r))
+		default:
+			return "#"
+		}
+	}
+
+	return "#"
+}
+
+// countInitials counts the songs in each jump bar bucket, including empty
+// buckets so the bar is always complete
+func countInitials(sngs []Song, name func(Song) string) []initialCount {
+	n := map[string]int{}
+	for _, sng := range sngs {
+		n[initial(name(sng))]++
+	}
+
+	ics := make([]initialCount, 0, len(initialBuckets))
+	for _, b := range initialBuckets {
+		ics = append(ics, initialCount{Initial: b, Count: n[b]})
+	}
+
+	return ics
+}
+
+// newSongbook lists songs by artist and then title for browsing
+func newSongbook(sngs []Song) songbook {
+	sort.SliceStable(sngs, func(i, j int) bool {
+		ai, aj := strings.ToLower(sngs[i].Artist), strings.ToLower(sngs[j].Artist)
+		if ai != aj {
+			return ai < aj
+		}
+
+		return strings.ToLower(sngs[i].Title) < strings.ToLower(sngs[j].Title)
+	})
+
+	sb := songbook{
+		Generated: time.Now().UTC(),
+		Count:     len(sngs),
+		Initials: songbookInitials{
+			Artists: countInitials(sngs, func(sng Song) string { return sng.Artist }),
+			Titles:  countInitials(sngs, func(sng Song) string { return sng.Title }),
+		},
+		Songs: make([]songbookSong, 0, len(sngs)),
+	}
+	for _, sng := range sngs {
+		sb.Songs = append(sb.Songs, songbookSong{
+			ID:        sng.ID,
+			Title:     sng.Title,
+			Artist:    sng.Artist,
+			Year:      sng.Year,
+			Duo:       sng.Duo,
+			Explicit:  sng.Explicit,
+			Styles:    sng.Styles,
+			Languages: sng.Languages,
+			Link:      karafunLink(sng.ID),
+			Initial:   initial(sng.Artist),
+			Key:       strings.ToLower(sng.Title + " " + sng.Artist),
+		})
+	}
+
+	return sb
+}
+
+// writeSongbook writes the songbook page and its search index to a directory
+func writeSongbook(dir string, title string, limit int, sb songbook) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(sb)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "songs.json"), b, 0644); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(dir, "index.html"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return songbookPage.Execute(f, map[string]any{
+		"Count":     sb.Count,
+		"Generated": sb.Generated,
+		"Limit":     limit,
+		"Title":     title,
+	})
+}
+
+func runPublish(args []string) int {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	out := fs.String("out", "songbook", "`directory` to write the songbook to")
+	filter := fs.String("filter", "", "MongoDB query `filter` (extended JSON) selecting the songs to publish (default all active songs)")
+	q := fs.String("q", "", "`query` selecting the songs to publish, e.g. style:rock -explicit")
+	clean := fs.Bool("clean", false, "leave explicit songs out of the songbook")
+	cleanSev := fs.String("clean-severity", "", "with -clean, also leave out songs with an advisory of at least this `level` ("+strings.Join(severities, ", ")+"; default only explicit songs)")
+	title := fs.String("title", "Songbook", "the `title` of the songbook page")
+	lmt := fs.Int("limit", 200, "maximum number of search results shown at once")
+	fs.StringVar(&songLink, "song-link", songLink, "`template` of the KaraFun link to each song, {id} is replaced by the song ID (empty for no links)")
+	fs.Parse(args)
+
+	if *lmt < 1 {
+		fmt.Println("Error: -limit must be at least 1")
+		fs.Usage()
+		return exitConfig
+	}
+
+	qry := bson.M{"status": statusActive}
+	if *filter != "" || *q != "" {
+		f, err := songsFilter("", *filter, *q)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			fs.Usage()
+			return exitConfig
+		}
+
+		qry = bson.M{"$and": bson.A{qry, f}}
+	}
+
+	if *cleanSev != "" && !*clean {
+		fmt.Println("Error: -clean-severity requires -clean")
+		fs.Usage()
+		return exitConfig
+	}
+
+	if *clean {
+		cln := bson.M{"explicit": false}
+		if *cleanSev != "" {
+			lvl, ok := parseSeverity(*cleanSev)
+			if !ok {
+				fmt.Printf("Error: clean severity must be one of %s\n", strings.Join(severities, ", "))
+				fs.Usage()
+				return exitConfig
+			}
+
+			// songs without an advisory have no severity and are kept
+			cln["advisory.severity"] = bson.M{"$not": bson.M{"$gte": lvl}}
+		}
+
+		qry = bson.M{"$and": bson.A{qry, cln}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	cur, err := c.Database(karaokeDB).Collection(songsCollection).Find(ctx, qry, options.Find().SetProjection(bson.M{"embedding": 0}))
+	if err != nil {
+		fmt.Printf("Error retrieving songs: %v", err)
+		panic(err)
+	}
+
+	var sngs []Song
+	if err = cur.All(ctx, &sngs); err != nil {
+		fmt.Printf("Error reading songs: %v", err)
+		panic(err)
+	}
+
+	if err := writeSongbook(*out, *title, *lmt, newSongbook(sngs)); err != nil {
+		fmt.Printf("Error writing songbook (%s): %v", *out, err)
+		panic(err)
+	}
+
+	fmt.Printf("Published %d songs to %s\n", len(sngs), *out)
+
+	return exitOK
+}
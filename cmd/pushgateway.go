@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// pushgatewayJob is the job the import's metrics are grouped under
+	pushgatewayJob = "karaoke_import"
+	// enrichmentJob is the job enrichment runs' metrics are grouped under
+	enrichmentJob = "karaoke_enrichment"
+)
+
+var (
+	pushgatewayTimeout = providerTimeout("PUSHGATEWAY", 10*time.Second)
+	pushgatewayURL     = os.Getenv("KARAOKE_PUSHGATEWAY")
+)
+
+// importMetrics formats the summary of an import in the Prometheus text
+// format; the last success time is only included when the import succeeded
+// so a failed run does not hide when the catalog was last imported
+func importMetrics(ok bool, at time.Time) string {
+	var b strings.Builder
+	metric := func(name string, help string, v any) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, v)
+	}
+
+	succ := 0
+	if ok {
+		succ = 1
+	}
+
+	metric("karaoke_import_success", "Whether the last import completed (1) or failed (0).", succ)
+	metric("karaoke_import_duration_seconds", "How long the last import ran.", float64(summary.DurationMs)/1000)
+	metric("karaoke_import_errors", "The errors reported by the last import.", len(summary.Errors))
+	metric("karaoke_import_conflicts", "The songs whose local edits the last import kept.", summary.Conflicts)
+
+	fmt.Fprintf(&b, "# HELP karaoke_import_songs The songs the last import processed, by result.\n# TYPE karaoke_import_songs gauge\n")
+	for _, r := range []struct {
+		name string
+		n    int
+	}{
+		{"inserted", summary.Inserted},
+		{"updated", summary.Updated},
+		{"unchanged", summary.Unchanged},
+		{"skipped", summary.Skipped},
+		{"pruned", summary.Pruned},
+	} {
+		fmt.Fprintf(&b, "karaoke_import_songs{result=\"%s\"} %d\n", r.name, r.n)
+	}
+
+	metric("karaoke_import_last_run_timestamp_seconds", "When the last import ran.", at.Unix())
+	if ok {
+		metric("karaoke_import_last_success_timestamp_seconds", "When the last successful import ran.", at.Unix())
+	}
+
+	return b.String()
+}
+
+// enrichmentMetrics formats the summary of an enrichment run in the
+// Prometheus text format, with the state its breaker ended in as one gauge
+// per state
+func enrichmentMetrics(s enrichmentSummary, at time.Time) string {
+	var b strings.Builder
+	metric := func(name string, help string, v any) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, v)
+	}
+
+	metric("karaoke_enrichment_duration_seconds", "How long the last enrichment run took.", float64(s.DurationMs)/1000)
+
+	fmt.Fprintf(&b, "# HELP karaoke_enrichment_songs The songs the last enrichment run processed, by result.\n# TYPE karaoke_enrichment_songs gauge\n")
+	for _, r := range []struct {
+		name string
+		n    int
+	}{
+		{"enriched", s.Enriched},
+		{"failed", s.Failed},
+		{"skipped", s.Skipped},
+	} {
+		fmt.Fprintf(&b, "karaoke_enrichment_songs{result=\"%s\"} %d\n", r.name, r.n)
+	}
+
+	fmt.Fprintf(&b, "# HELP karaoke_enrichment_breaker_state The state the provider's circuit breaker ended the last run in.\n# TYPE karaoke_enrichment_breaker_state gauge\n")
+	for _, st := range []string{"closed", "half-open", "open"} {
+		v := 0
+		if st == s.Breaker.State {
+			v = 1
+		}
+
+		fmt.Fprintf(&b, "karaoke_enrichment_breaker_state{state=\"%s\"} %d\n", st, v)
+	}
+
+	metric("karaoke_enrichment_breaker_trips", "The times the provider's circuit breaker opened in the last run.", s.Breaker.Trips)
+	metric("karaoke_enrichment_last_run_timestamp_seconds", "When the last enrichment run ran.", at.Unix())
+
+	return b.String()
+}
+
+// pushImportMetrics pushes the summary of an import to the configured
+// Pushgateway, grouped by job and source and replacing only the metrics it
+// sends; failures are printed and otherwise ignored
+func pushImportMetrics(src string, ok bool, at time.Time) {
+	// sources are paths and urls, so the grouping label is base64 encoded
+	pushMetrics("import", url.PathEscape(pushgatewayJob)+"/source@base64/"+base64.RawURLEncoding.EncodeToString([]byte(src)), importMetrics(ok, at))
+}
+
+// pushEnrichmentMetrics pushes the summary of an enrichment run to the
+// configured Pushgateway, grouped by job and command
+func pushEnrichmentMetrics(cmd string, s enrichmentSummary, at time.Time) {
+	pushMetrics(cmd, url.PathEscape(enrichmentJob)+"/command/"+url.PathEscape(cmd), enrichmentMetrics(s, at))
+}
+
+// pushMetrics pushes metrics to the group of the configured Pushgateway,
+// replacing only the metrics sent; failures are printed and otherwise
+// ignored
+func pushMetrics(what string, grp string, body string) {
+	if pushgatewayURL == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pushgatewayTimeout)
+	defer cancel()
+
+	u := strings.TrimSuffix(pushgatewayURL, "/") + "/metrics/job/" + grp
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(body))
+	if err != nil {
+		fmt.Printf("Error pushing %s metrics (%s): %v\n", what, pushgatewayURL, err)
+		return
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		fmt.Printf("Error pushing %s metrics (%s): %v\n", what, pushgatewayURL, err)
+		return
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		fmt.Printf("Error pushing %s metrics (%s): unexpected response: %s\n", what, pushgatewayURL, res.Status)
+	}
+}
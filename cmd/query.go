@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	// queryFields are the fields a query can match by name, mapped to the
+	// stored field; text fields match anywhere, the others match a whole value
+	queryFields = map[string]string{
+		"artist":   "artist",
+		"id":       "id",
+		"language": "languages",
+		"mood":     "mood",
+		"region":   "regions",
+		"status":   "status",
+		"style":    "styles",
+		"tag":      "tags",
+		"title":    "title",
+		"year":     "year",
+	}
+	queryFlags = map[string]string{
+		"duo":      "duo",
+		"explicit": "explicit",
+	}
+	queryText = map[string]bool{"artist": true, "title": true}
+)
+
+// queryTerms splits a query into terms on whitespace outside of quotes,
+// removing the quotes
+func queryTerms(q string) ([]string, error) {
+	var trms []string
+	var b strings.Builder
+	quoted, started := false, false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			quoted, started = !quoted, true
+		case unicode.IsSpace(r) && !quoted:
+			if started {
+				trms = append(trms, b.String())
+				b.Reset()
+			}
+			started = false
+		default:
+			b.WriteRune(r)
+			started = true
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in query")
+	}
+
+	if started {
+		trms = append(trms, b.String())
+	}
+
+	return trms, nil
+}
+
+// queryYears matches a year or an inclusive range of years, either end of
+// which may be left open (1975, 1975..1985, 1990.., ..1969)
+func queryYears(v string) (bson.M, error) {
+	lo, hi, rng := strings.Cut(v, "..")
+	if !rng {
+		yr, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid year: %s", v)
+		}
+
+		return bson.M{"year": yr}, nil
+	}
+
+	cnd := bson.M{}
+	for op, s := range map[string]string{"$gte": lo, "$lte": hi} {
+		if s == "" {
+			continue
+		}
+
+		yr, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid year range: %s", v)
+		}
+		cnd[op] = yr
+	}
+
+	if len(cnd) == 0 {
+		return nil, fmt.Errorf("invalid year range: %s", v)
+	}
+
+	return bson.M{"year": cnd}, nil
+}
+
+// queryTerm converts one term of a query into a filter
+func queryTerm(trm string) (bson.M, error) {
+	name, v, ok := strings.Cut(trm, ":")
+	if !ok {
+		// a bare flag, or a word matched against the title and artist
+		if f, ok := queryFlags[strings.ToLower(trm)]; ok {
+			return bson.M{f: true}, nil
+		}
+
+		rx := bson.M{"$regex": regexp.QuoteMeta(trm), "$options": "i"}
+		return bson.M{"$or": bson.A{bson.M{"title": rx}, bson.M{"artist": rx}}}, nil
+	}
+
+	name = strings.ToLower(name)
+	fld, ok := queryFields[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown query field: %s", name)
+	}
+
+	if v == "" {
+		return nil, fmt.Errorf("missing value for query field: %s", name)
+	}
+
+	switch {
+	case name == "year":
+		return queryYears(v)
+	case name == "id":
+		id, err := parseSongID(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid song id: %s", v)
+		}
+
+		return bson.M{"id": id}, nil
+	case queryText[name]:
+		return bson.M{fld: bson.M{"$regex": regexp.QuoteMeta(v), "$options": "i"}}, nil
+	default:
+		return bson.M{fld: bson.M{"$regex": "^" + regexp.QuoteMeta(v) + "$", "$options": "i"}}, nil
+	}
+}
+
+// parseQuery converts a query such as
+//
+//	artist:"queen" year:1975..1985 style:rock -explicit
+//
+// into a filter matching songs that satisfy every term; a leading - negates
+// a term and quotes keep spaces within a value
+func parseQuery(q string) (bson.M, error) {
+	trms, err := queryTerms(q)
+	if err != nil {
+		return nil, err
+	}
+
+	var cnds bson.A
+	for _, trm := range trms {
+		neg := strings.HasPrefix(trm, "-") && len(trm) > 1
+		if neg {
+			trm = trm[1:]
+		}
+
+		cnd, err := queryTerm(trm)
+		if err != nil {
+			return nil, err
+		}
+
+		if neg {
+			cnd = bson.M{"$nor": bson.A{cnd}}
+		}
+		cnds = append(cnds, cnd)
+	}
+
+	switch len(cnds) {
+	case 0:
+		return nil, fmt.Errorf("query is empty")
+	case 1:
+		return cnds[0].(bson.M), nil
+	default:
+		return bson.M{"$and": cnds}, nil
+	}
+}
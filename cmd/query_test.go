@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestQueryTerms(t *testing.T) {
+	for _, tc := range []struct {
+		q    string
+		want []string
+		err  bool
+	}{
+		{q: "queen rock", want: []string{"queen", "rock"}},
+		{q: `  artist:"the beatles"   year:1965 `, want: []string{"artist:the beatles", "year:1965"}},
+		{q: `title:""`, want: []string{"title:"}},
+		{q: `"don't stop" -explicit`, want: []string{"don't stop", "-explicit"}},
+		{q: `artist:"queen`, err: true},
+	} {
+		got, err := queryTerms(tc.q)
+		if tc.err {
+			if err == nil {
+				t.Errorf("queryTerms(%s) accepted", tc.q)
+			}
+			continue
+		}
+
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("queryTerms(%s) = %q, %v, want %q", tc.q, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	rx := func(p string) bson.M {
+		return bson.M{"$regex": p, "$options": "i"}
+	}
+
+	for _, tc := range []struct {
+		q    string
+		want bson.M
+	}{
+		{q: "queen", want: bson.M{"$or": bson.A{bson.M{"title": rx("queen")}, bson.M{"artist": rx("queen")}}}},
+		{q: "duo", want: bson.M{"duo": true}},
+		{q: "-Explicit", want: bson.M{"$nor": bson.A{bson.M{"explicit": true}}}},
+		{q: `artist:"a-ha"`, want: bson.M{"artist": rx(`a-ha`)}},
+		{q: "title:(live)", want: bson.M{"title": rx(`\(live\)`)}},
+		{q: "style:rock", want: bson.M{"styles": rx("^rock$")}},
+		{q: "TAG:holiday", want: bson.M{"tags": rx("^holiday$")}},
+		{q: "id:49375", want: bson.M{"id": SongID("49375")}},
+		{q: "year:1975", want: bson.M{"year": 1975}},
+		{q: "year:1975..1985", want: bson.M{"year": bson.M{"$gte": 1975, "$lte": 1985}}},
+		{q: "year:1990..", want: bson.M{"year": bson.M{"$gte": 1990}}},
+		{q: "year:..1969", want: bson.M{"year": bson.M{"$lte": 1969}}},
+		{q: "queen year:1975", want: bson.M{"$and": bson.A{
+			bson.M{"$or": bson.A{bson.M{"title": rx("queen")}, bson.M{"artist": rx("queen")}}},
+			bson.M{"year": 1975},
+		}}},
+		{q: "-", want: bson.M{"$or": bson.A{bson.M{"title": rx("-")}, bson.M{"artist": rx("-")}}}},
+	} {
+		got, err := parseQuery(tc.q)
+		if err != nil {
+			t.Errorf("parseQuery(%s): %v", tc.q, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseQuery(%s) = %v, want %v", tc.q, got, tc.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, q := range []string{
+		"",
+		"   ",
+		"venue:apollo",
+		"style:",
+		"year:recent",
+		"year:1975..later",
+		"year:..",
+		"id:",
+		`artist:"queen`,
+	} {
+		if _, err := parseQuery(q); err == nil {
+			t.Errorf("parseQuery(%q) accepted", q)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	region      string
+	regionsPath string
+)
+
+// licensedIn reports whether a song may be offered in the region; songs
+// without region data are licensed everywhere
+func licensedIn(sng Song, rgn string) bool {
+	if len(sng.Regions) == 0 {
+		return true
+	}
+
+	for _, r := range sng.Regions {
+		if strings.EqualFold(r, rgn) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readRegions reads a mapping file of song IDs to the comma separated
+// regions (e.g. US,CA,GB) each song is licensed in
+func readRegions(path string) map[SongID][]string {
+	rf, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Error opening file (%s): %v", path, err)
+		panic(exitError{exitSource, err})
+	}
+	defer rf.Close()
+
+	// short rows are read so they can be skipped below
+	rcrds, err := readCSV(rf)
+	if err != nil {
+		fmt.Printf("Error parsing CSV file (%s): %v", path, err)
+		panic(exitError{exitSource, err})
+	}
+
+	rgns := make(map[SongID][]string, len(rcrds))
+	for i, rcrd := range rcrds {
+		// skip the header and malformed rows
+		if i == 0 || len(rcrd) < 2 {
+			continue
+		}
+
+		id, err := parseSongID(rcrd[0])
+		if err != nil {
+			continue
+		}
+
+		for _, r := range splitList(rcrd[1]) {
+			rgns[id] = append(rgns[id], strings.ToUpper(r))
+		}
+	}
+
+	return rgns
+}
+
+// applyRegions sets the licensed regions on each song from the mapping file
+// and removes songs that are not licensed in the deployment's region
+func applyRegions(sngs []Song) []Song {
+	var rgns map[SongID][]string
+	if regionsPath != "" {
+		rgns = readRegions(regionsPath)
+	}
+
+	lsngs := sngs[:0]
+	for _, sng := range sngs {
+		if r, ok := rgns[sng.ID]; ok {
+			sng.Regions = r
+		}
+
+		if region != "" && !licensedIn(sng, region) {
+			continue
+		}
+
+		lsngs = append(lsngs, sng)
+	}
+
+	summary.Skipped += len(sngs) - len(lsngs)
+	if region != "" && len(lsngs) < len(sngs) {
+		fmt.Printf("Skipping %d songs not licensed in %s\n", len(sngs)-len(lsngs), region)
+	}
+
+	return lsngs
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadRegions(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "regions.csv")
+	csv := "\ufeffId;Regions\n" +
+		"6534;us, ca,gb\n" +
+		"49375\n" +
+		";US\n" +
+		"73087;FR;extra\n" +
+		"104233;\n"
+	if err := os.WriteFile(p, []byte(csv), 0644); err != nil {
+		t.Fatalf("writing %s: %v", p, err)
+	}
+
+	want := map[SongID][]string{
+		"6534":  {"US", "CA", "GB"},
+		"73087": {"FR"},
+	}
+	if got := readRegions(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("readRegions = %v, want %v", got, want)
+	}
+}
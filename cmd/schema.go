@@ -0,0 +1,480 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// schema strictness levels: lenient accepts invalid writes and leaves the
+// server to log them, moderate rejects invalid fields but tolerates unknown
+// fields, and strict also rejects unknown fields
+const (
+	schemaLenient  = "lenient"
+	schemaModerate = "moderate"
+	schemaStrict   = "strict"
+)
+
+var (
+	schemaStrictness   = os.Getenv("KARAOKE_SCHEMA_STRICTNESS")
+	schemaStrictnesses = []string{schemaLenient, schemaModerate, schemaStrict}
+)
+
+// schemaOverrides are merged into the generated schema of the property at
+// each path for constraints that struct tags can not express
+var schemaOverrides = map[string]bson.M{
+	"advisory.severity": {"minimum": 0, "maximum": len(severities) - 1},
+	"difficulty.level":  {"minimum": 0, "maximum": len(difficulties) - 1},
+	"mood":              {"enum": append([]string{""}, moods...)},
+	"status":            {"enum": statuses},
+}
+
+// songDocument is the shape of a stored song: the imported fields and their
+// provenance plus the local fields maintained outside of imports
+type songDocument struct {
+	Song            `bson:",inline"`
+	Provenance      `bson:",inline"`
+	Advisory        *Advisory   `bson:"advisory" description:"the content advisory for the song (never set by imports)"`
+	Difficulty      *Difficulty `bson:"difficulty" description:"the singing difficulty and vocal range of the song (never set by imports)"`
+	Embedding       []float64   `bson:"embedding" description:"the vector embedding of the song's title, artist, styles, and languages"`
+	EmbeddingHash   string      `bson:"embeddingHash" description:"the hash of the model and text the embedding was computed from"`
+	Preview         *Preview    `bson:"preview" description:"the preview clip of the song (never set by imports)"`
+	Status          string      `bson:"status" description:"the availability of the song (active, unavailable, or removed)"`
+	StatusChangedAt time.Time   `bson:"statusChangedAt" description:"the date the availability of the song last changed"`
+	Tags            []string    `bson:"tags" description:"the house tags applied to the song (never set by imports)"`
+}
+
+// bsonField returns the stored name of a struct field and whether it is
+// inlined, or an empty name when the field is not stored
+func bsonField(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+
+	tag, ok := f.Tag.Lookup("bson")
+	if !ok {
+		return strings.ToLower(f.Name), false
+	}
+
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "-" {
+		return "", false
+	}
+
+	return name, strings.Contains(opts, "inline")
+}
+
+// typeSchema returns the validator types expected for a Go type as stored
+// by the driver (ints that fit are stored as int32)
+func typeSchema(t reflect.Type) bson.M {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == reflect.TypeOf(SongID("")):
+		return bson.M{"bsonType": songIDTypes}
+	case t == reflect.TypeOf(time.Time{}):
+		return bson.M{"bsonType": "date"}
+	case t == reflect.TypeOf(primitive.ObjectID{}):
+		return bson.M{"bsonType": "objectId"}
+	case t.Kind() == reflect.Bool:
+		return bson.M{"bsonType": "bool"}
+	case t.Kind() == reflect.Int, t.Kind() == reflect.Int32:
+		return bson.M{"bsonType": "int"}
+	case t.Kind() == reflect.Int64:
+		return bson.M{"bsonType": "long"}
+	case t.Kind() == reflect.Float32, t.Kind() == reflect.Float64:
+		return bson.M{"bsonType": "double"}
+	case t.Kind() == reflect.String:
+		return bson.M{"bsonType": "string"}
+	case t.Kind() == reflect.Slice:
+		return bson.M{"bsonType": "array", "items": typeSchema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return bson.M{"bsonType": "object"}
+	case t.Kind() == reflect.Struct:
+		return bson.M{"bsonType": "object", "properties": structProperties(t)}
+	default:
+		return bson.M{}
+	}
+}
+
+// documentSchema generates the $jsonSchema for a Go type from the bson,
+// schema ("required"), and description struct tags of its fields, applying
+// schemaOverrides by dotted path
+func documentSchema(t reflect.Type, path string) bson.M {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var sch bson.M
+	switch {
+	case t.Kind() == reflect.Slice:
+		sch = bson.M{"bsonType": "array", "items": documentSchema(t.Elem(), path)}
+	case t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{}):
+		props, req := bson.M{}, []string{}
+		documentFields(t, path, props, &req)
+
+		sch = bson.M{"bsonType": "object", "properties": props}
+		if len(req) > 0 {
+			sch["required"] = req
+		}
+	default:
+		sch = typeSchema(t)
+	}
+
+	for k, v := range schemaOverrides[path] {
+		sch[k] = v
+	}
+
+	for k, v := range validatorOverrides[path] {
+		sch[k] = v
+	}
+
+	return sch
+}
+
+// documentFields adds the generated schema of each stored field of a struct,
+// including inlined structs, to the properties and required fields
+func documentFields(t reflect.Type, path string, props bson.M, req *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, inl := bsonField(f)
+		if inl {
+			documentFields(f.Type, path, props, req)
+			continue
+		}
+
+		if name == "" {
+			continue
+		}
+
+		p := strings.TrimPrefix(path+"."+name, ".")
+		sch := documentSchema(f.Type, p)
+		if d := f.Tag.Get("description"); d != "" {
+			sch["description"] = d
+		}
+
+		if f.Tag.Get("schema") == "required" {
+			*req = append(*req, name)
+		}
+
+		props[name] = sch
+	}
+}
+
+// structProperties returns the expected validator properties for the stored
+// fields of a struct, including inlined structs
+func structProperties(t reflect.Type) bson.M {
+	props := bson.M{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, inl := bsonField(f)
+		if name == "" && !inl {
+			continue
+		}
+
+		if inl {
+			for k, v := range structProperties(f.Type) {
+				props[k] = v
+			}
+
+			continue
+		}
+
+		props[name] = typeSchema(f.Type)
+	}
+
+	return props
+}
+
+// schemaDrift compares the validator types derived from a struct with a
+// $jsonSchema and describes each property that is missing, unexpected, or
+// of the wrong type
+func schemaDrift(path string, want bson.M, have bson.M) []string {
+	var drft []string
+	if wt, ht := want["bsonType"], have["bsonType"]; wt != nil && ht != nil && fmt.Sprint(wt) != fmt.Sprint(ht) {
+		drft = append(drft, fmt.Sprintf("%s: schema type is %v, struct type is %v", path, ht, wt))
+		return drft
+	}
+
+	if wi, ok := want["items"].(bson.M); ok {
+		if hi, ok := have["items"].(bson.M); ok {
+			drft = append(drft, schemaDrift(path+"[]", wi, hi)...)
+		}
+	}
+
+	wp, _ := want["properties"].(bson.M)
+	hp, _ := have["properties"].(bson.M)
+	for _, k := range sortedKeys(wp, hp) {
+		p := strings.TrimPrefix(path+"."+k, ".")
+		wf, wok := wp[k].(bson.M)
+		hf, hok := hp[k].(bson.M)
+
+		switch {
+		case !hok:
+			drft = append(drft, fmt.Sprintf("%s: missing from schema", p))
+		case !wok:
+			drft = append(drft, fmt.Sprintf("%s: in schema but not a stored field", p))
+		default:
+			drft = append(drft, schemaDrift(p, wf, hf)...)
+		}
+	}
+
+	return drft
+}
+
+// definitionsDrift describes each index in the definitions that refers to a
+// field the schema does not have, which Go type changes can leave behind
+func definitionsDrift(defs definitions, sch bson.M) []string {
+	var drft []string
+	for i, d := range defs.Indexes {
+		for _, k := range d.Keys {
+			if !schemaHasPath(sch, k.Field) {
+				drft = append(drft, fmt.Sprintf("%s: index %d refers to a field missing from schema", k.Field, i+1))
+			}
+		}
+	}
+
+	return drft
+}
+
+// sortedKeys returns the keys of the maps in order
+func sortedKeys(ms ...bson.M) []string {
+	set := map[string]bool{}
+	for _, m := range ms {
+		for k := range m {
+			set[k] = true
+		}
+	}
+
+	ks := make([]string, 0, len(set))
+	for k := range set {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+
+	return ks
+}
+
+// liveSchemaDrift compares the validator of the live songs collection with
+// songsSchema property by property
+func liveSchemaDrift(ctx context.Context) []string {
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	cur, err := c.Database(karaokeDB).ListCollections(ctx, bson.M{"name": songsCollection})
+	if err != nil {
+		fmt.Printf("Error retrieving collections: %v", err)
+		panic(err)
+	}
+
+	var clcts []struct {
+		Options struct {
+			Validator struct {
+				Schema bson.M `bson:"$jsonSchema"`
+			} `bson:"validator"`
+			ValidationAction string `bson:"validationAction"`
+		} `bson:"options"`
+	}
+	if err = cur.All(ctx, &clcts); err != nil {
+		fmt.Printf("Error reading collections: %v", err)
+		panic(err)
+	}
+
+	if len(clcts) == 0 || clcts[0].Options.Validator.Schema == nil {
+		return []string{fmt.Sprintf("%s: no validator (run an import to create it)", songsCollection)}
+	}
+
+	live := clcts[0].Options.Validator.Schema
+	var drft []string
+	cmpr := func(name string, want any, have any) {
+		w, err := canonicalDefinition(bson.M{"v": want})
+		if err != nil {
+			fmt.Printf("Error encoding schema: %v", err)
+			panic(err)
+		}
+
+		h, err := canonicalDefinition(bson.M{"v": have})
+		if err != nil {
+			fmt.Printf("Error encoding live validator: %v", err)
+			panic(err)
+		}
+
+		if w != h {
+			drft = append(drft, fmt.Sprintf("%s: live validator differs from schema", name))
+		}
+	}
+
+	want := validatorSchema()
+	cmpr("required", want["required"], live["required"])
+	cmpr("additionalProperties", want["additionalProperties"], live["additionalProperties"])
+
+	// the server omits the default action
+	if act := clcts[0].Options.ValidationAction; act != validationAction() && !(act == "" && validationAction() == "error") {
+		drft = append(drft, fmt.Sprintf("%s: live validation action is %q, expected %q", songsCollection, act, validationAction()))
+	}
+
+	wp, _ := want["properties"].(bson.M)
+	hp, _ := live["properties"].(bson.M)
+	for _, k := range sortedKeys(wp, hp) {
+		cmpr(k, wp[k], hp[k])
+	}
+
+	return drft
+}
+
+// validStrictness reports whether the schema strictness is known, defaulting
+// it to moderate when unset
+func validStrictness() bool {
+	if schemaStrictness == "" {
+		schemaStrictness = schemaModerate
+	}
+
+	for _, s := range schemaStrictnesses {
+		if s == schemaStrictness {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validatorSchema is the validator applied at the configured strictness;
+// strict validators reject properties the schema does not know
+func validatorSchema() bson.M {
+	if schemaStrictness != schemaStrict {
+		return songsSchema
+	}
+
+	props := bson.M{"_id": bson.M{"bsonType": "objectId"}}
+	for k, v := range songsSchema["properties"].(bson.M) {
+		props[k] = v
+	}
+
+	sch := bson.M{"additionalProperties": false, "properties": props}
+	for k, v := range songsSchema {
+		if k != "properties" {
+			sch[k] = v
+		}
+	}
+
+	return sch
+}
+
+// validationAction is what the server does with an invalid write: reject
+// it, or accept it and log a warning when lenient
+func validationAction() string {
+	if schemaStrictness == schemaLenient {
+		return "warn"
+	}
+
+	return "error"
+}
+
+// unknownFields returns the top level fields of the live songs that the
+// schema does not know, and the number of songs with each
+func unknownFields(ctx context.Context) []bucket {
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	cur, err := c.Database(karaokeDB).Collection(songsCollection).Aggregate(ctx, append(mongo.Pipeline{
+		bson.D{primitive.E{
+			Key:   "$project",
+			Value: bson.M{"_id": 0, "k": bson.M{"$map": bson.M{"input": bson.M{"$objectToArray": "$$ROOT"}, "in": "$$this.k"}}},
+		}},
+		bson.D{primitive.E{Key: "$unwind", Value: "$k"}},
+	}, countBy("$k", false)...))
+	if err != nil {
+		fmt.Printf("Error aggregating song fields: %v", err)
+		panic(err)
+	}
+
+	var flds []bucket
+	if err = cur.All(ctx, &flds); err != nil {
+		fmt.Printf("Error reading song fields: %v", err)
+		panic(err)
+	}
+
+	props := songsSchema["properties"].(bson.M)
+	var unk []bucket
+	for _, f := range flds {
+		k, _ := f.Value.(string)
+		if _, ok := props[k]; !ok && k != "_id" {
+			unk = append(unk, f)
+		}
+	}
+
+	return unk
+}
+
+func runSchema(args []string) int {
+	if len(args) == 0 || (args[0] != "check" && args[0] != "report" && args[0] != "definitions") {
+		fmt.Println("Error: usage: schema check [-schema-strictness level] | schema report | schema definitions")
+		return exitConfig
+	}
+
+	if args[0] == "report" {
+		return runSchemaReport()
+	}
+
+	if args[0] == "definitions" {
+		return printDefinitions()
+	}
+
+	fs := flag.NewFlagSet("schema check", flag.ExitOnError)
+	fs.StringVar(&schemaStrictness, "schema-strictness", schemaStrictness, "the validator `strictness` to expect ("+strings.Join(schemaStrictnesses, ", ")+"; defaults to KARAOKE_SCHEMA_STRICTNESS or moderate)")
+	fs.Parse(args[1:])
+
+	if !validStrictness() {
+		fmt.Printf("Error: -schema-strictness must be one of %s\n", strings.Join(schemaStrictnesses, ", "))
+		fs.Usage()
+		return exitConfig
+	}
+
+	// the generated schema is checked against the Go types by the golden
+	// file test, so only the definitions and the live collection can drift
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	drft := definitionsDrift(songsDefinitions, songsSchema)
+	drft = append(drft, liveSchemaDrift(ctx)...)
+
+	for _, d := range drft {
+		fmt.Println(d)
+	}
+
+	if len(drft) > 0 {
+		fmt.Printf("Schema check found %d differences\n", len(drft))
+		return exitFailure
+	}
+
+	fmt.Println("Schema check passed")
+
+	return exitOK
+}
+
+// runSchemaReport warns about the fields of live songs the schema does not
+// know, such as fields written by a newer release during a rolling upgrade
+func runSchemaReport() int {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	unk := unknownFields(ctx)
+	for _, f := range unk {
+		fmt.Printf("Warning: unknown field (%v) on %d songs\n", f.Value, f.Count)
+	}
+
+	fmt.Printf("Schema report found %d unknown fields\n", len(unk))
+
+	return exitOK
+}
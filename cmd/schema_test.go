@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// songsSchemaGolden is the committed validator generated from the Go types
+// and the embedded definitions
+var songsSchemaGolden = filepath.Join("testdata", "songs_schema.json")
+
+// loadEmbeddedDefinitions applies the embedded definitions for a test
+func loadEmbeddedDefinitions(t *testing.T) {
+	t.Helper()
+
+	definitionsPath = ""
+	loadDefinitions()
+}
+
+func TestSongsSchemaGolden(t *testing.T) {
+	loadEmbeddedDefinitions(t)
+
+	got, err := json.MarshalIndent(songsSchema, "", "  ")
+	if err != nil {
+		t.Fatalf("encoding schema: %v", err)
+	}
+	got = append(got, '\n')
+
+	if *updateGolden {
+		if err := os.WriteFile(songsSchemaGolden, got, 0644); err != nil {
+			t.Fatalf("writing %s: %v", songsSchemaGolden, err)
+		}
+	}
+
+	want, err := os.ReadFile(songsSchemaGolden)
+	if err != nil {
+		t.Fatalf("reading %s: %v", songsSchemaGolden, err)
+	}
+
+	if bytes.Equal(got, want) {
+		return
+	}
+
+	var wsch bson.M
+	if err := bson.UnmarshalExtJSON(want, false, &wsch); err != nil {
+		t.Fatalf("decoding %s: %v", songsSchemaGolden, err)
+	}
+
+	for _, d := range schemaDrift("", songsSchema, wsch) {
+		t.Error(d)
+	}
+	t.Errorf("schema generated from the Go types differs from %s; review the change and rerun with -update", songsSchemaGolden)
+}
+
+func TestSongsSchemaMatchesTypes(t *testing.T) {
+	loadEmbeddedDefinitions(t)
+
+	for _, d := range schemaDrift("", typeSchema(reflect.TypeOf(songDocument{})), songsSchema) {
+		t.Error(d)
+	}
+}
+
+func TestDefinitionsDrift(t *testing.T) {
+	loadEmbeddedDefinitions(t)
+
+	for _, d := range definitionsDrift(songsDefinitions, songsSchema) {
+		t.Error(d)
+	}
+
+	defs := definitions{Indexes: []indexDefinition{
+		{Keys: []indexKey{{Field: "title", Order: 1}}},
+		{Keys: []indexKey{{Field: "venue", Order: 1}}},
+		{Keys: []indexKey{{Field: "advisory.rating", Order: 1}}},
+	}}
+	if drft := definitionsDrift(defs, songsSchema); len(drft) != 2 {
+		t.Errorf("definitionsDrift = %q, want drift for venue and advisory.rating", drft)
+	}
+}
+
+func TestSchemaDrift(t *testing.T) {
+	want := bson.M{"bsonType": "object", "properties": bson.M{
+		"title": bson.M{"bsonType": "string"},
+		"year":  bson.M{"bsonType": "int"},
+		"tags":  bson.M{"bsonType": "array", "items": bson.M{"bsonType": "string"}},
+	}}
+	have := bson.M{"bsonType": "object", "properties": bson.M{
+		"year":  bson.M{"bsonType": "string"},
+		"tags":  bson.M{"bsonType": "array", "items": bson.M{"bsonType": "int"}},
+		"venue": bson.M{"bsonType": "string"},
+	}}
+
+	got := schemaDrift("", want, have)
+	exp := []string{
+		"tags[]: schema type is int, struct type is string",
+		"title: missing from schema",
+		"venue: in schema but not a stored field",
+		"year: schema type is string, struct type is int",
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("schemaDrift = %q, want %q", got, exp)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const songsSearchIndexName = "songs_search"
+
+var (
+	atlasSearch bool
+	// songsSearchIndex is the Atlas Search definition for the songs
+	// collection, with full text and autocomplete on title and artist
+	songsSearchIndex = bson.M{
+		"analyzer": "lucene.standard",
+		"mappings": bson.M{
+			"dynamic": false,
+			"fields": bson.M{
+				"title":     searchTextField,
+				"artist":    searchTextField,
+				"styles":    bson.M{"type": "token"},
+				"languages": bson.M{"type": "token"},
+				"tags":      bson.M{"type": "token"},
+				"mood":      bson.M{"type": "token"},
+				"status":    bson.M{"type": "token"},
+				"year":      bson.M{"type": "number"},
+				"explicit":  bson.M{"type": "boolean"},
+			},
+		},
+	}
+	searchTextField = bson.A{
+		bson.M{
+			"type":     "string",
+			"analyzer": "lucene.standard",
+		},
+		bson.M{
+			"type":           "autocomplete",
+			"tokenization":   "edgeGram",
+			"minGrams":       2,
+			"maxGrams":       15,
+			"foldDiacritics": true,
+		},
+	}
+)
+
+// canonicalDefinition renders a search index definition as JSON with sorted
+// keys so definitions can be compared regardless of map ordering
+func canonicalDefinition(def any) (string, error) {
+	b, err := bson.MarshalExtJSON(def, false, false)
+	if err != nil {
+		return "", err
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "", err
+	}
+
+	b, err = json.Marshal(m)
+	return string(b), err
+}
+
+// ensureSongsSearchIndex creates the Atlas Search index for the collection
+// or updates it when the definition has changed
+func ensureSongsSearchIndex(ctx context.Context, c *mongo.Client, name string) {
+	db := c.Database(karaokeDB)
+
+	// retrieve the existing search index (only supported by Atlas)
+	cur, err := db.Collection(name).Aggregate(ctx, mongo.Pipeline{
+		bson.D{primitive.E{
+			Key:   "$listSearchIndexes",
+			Value: bson.M{"name": songsSearchIndexName},
+		}},
+	})
+	if err != nil {
+		fmt.Printf("Error retrieving Atlas Search indices (is this an Atlas cluster?): %v", err)
+		panic(err)
+	}
+
+	var eidx []struct {
+		LatestDefinition bson.M `bson:"latestDefinition"`
+	}
+	if err = cur.All(ctx, &eidx); err != nil {
+		fmt.Printf("Error reading Atlas Search indices: %v", err)
+		panic(err)
+	}
+
+	// create the index when it does not exist yet
+	if len(eidx) == 0 {
+		cmd := bson.D{
+			primitive.E{
+				Key:   "createSearchIndexes",
+				Value: name,
+			},
+			primitive.E{
+				Key: "indexes",
+				Value: bson.A{bson.M{
+					"name":       songsSearchIndexName,
+					"definition": songsSearchIndex,
+				}},
+			},
+		}
+
+		if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+			fmt.Printf("Error creating Atlas Search index (%s): %v", songsSearchIndexName, err)
+			panic(err)
+		}
+
+		fmt.Printf("Created Atlas Search index (%s)\n", songsSearchIndexName)
+		return
+	}
+
+	// only update (and rebuild) the index when the definition changed
+	want, err := canonicalDefinition(songsSearchIndex)
+	if err != nil {
+		fmt.Printf("Error encoding Atlas Search index definition: %v", err)
+		panic(err)
+	}
+
+	have, err := canonicalDefinition(eidx[0].LatestDefinition)
+	if err != nil {
+		fmt.Printf("Error encoding existing Atlas Search index definition: %v", err)
+		panic(err)
+	}
+
+	if want == have {
+		return
+	}
+
+	cmd := bson.D{
+		primitive.E{
+			Key:   "updateSearchIndex",
+			Value: name,
+		},
+		primitive.E{
+			Key:   "name",
+			Value: songsSearchIndexName,
+		},
+		primitive.E{
+			Key:   "definition",
+			Value: songsSearchIndex,
+		},
+	}
+
+	if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+		fmt.Printf("Error updating Atlas Search index (%s): %v", songsSearchIndexName, err)
+		panic(err)
+	}
+
+	fmt.Printf("Updated Atlas Search index (%s)\n", songsSearchIndexName)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	sheetsScope = "https://www.googleapis.com/auth/spreadsheets.readonly"
+	sheetsURL   = "https://sheets.googleapis.com/v4/spreadsheets/%s/values/%s"
+)
+
+var (
+	sheetCredentials = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	sheetID          string
+	sheetRange       = "A:I"
+	sheetsTimeout    = providerTimeout("SHEETS", 30*time.Second)
+)
+
+// serviceAccount is the subset of a Google service account key file needed
+// to request an access token
+type serviceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// sheetSource reads records from a Google Sheet shared with a service
+// account, laid out with the same columns as the KaraFun export
+type sheetSource struct {
+	credentials string
+	id          string
+	rng         string
+}
+
+func (s sheetSource) String() string {
+	return fmt.Sprintf("sheet %s!%s", s.id, s.rng)
+}
+
+func (s sheetSource) Records() ([][]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sheetsTimeout)
+	defer cancel()
+
+	tkn, err := s.accessToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to authenticate service account: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf(sheetsURL, url.PathEscape(s.id), url.PathEscape(s.rng)),
+		nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+tkn)
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from Sheets API: %s", res.Status)
+	}
+
+	var vr struct {
+		Values [][]string `json:"values"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&vr); err != nil {
+		return nil, err
+	}
+
+	// the API omits trailing empty cells, so pad rows to the header width
+	for i, row := range vr.Values {
+		if w := len(vr.Values[0]); len(row) < w {
+			vr.Values[i] = append(row, make([]string, w-len(row))...)
+		}
+	}
+
+	return vr.Values, nil
+}
+
+// accessToken exchanges a signed JWT assertion for an OAuth access token
+func (s sheetSource) accessToken(ctx context.Context) (string, error) {
+	b, err := os.ReadFile(s.credentials)
+	if err != nil {
+		return "", err
+	}
+
+	var sa serviceAccount
+	if err := json.Unmarshal(b, &sa); err != nil {
+		return "", err
+	}
+
+	blk, _ := pem.Decode([]byte(sa.PrivateKey))
+	if blk == nil {
+		return "", fmt.Errorf("invalid private key in %s", s.credentials)
+	}
+
+	k, err := x509.ParsePKCS8PrivateKey(blk.Bytes)
+	if err != nil {
+		return "", err
+	}
+
+	rk, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("private key in %s is not an RSA key", s.credentials)
+	}
+
+	// build and sign the assertion
+	now := time.Now()
+	hdr, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	clms, _ := json.Marshal(map[string]any{
+		"iss":   sa.ClientEmail,
+		"scope": sheetsScope,
+		"aud":   sa.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+
+	enc := base64.RawURLEncoding
+	uns := enc.EncodeToString(hdr) + "." + enc.EncodeToString(clms)
+	dgst := sha256.Sum256([]byte(uns))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, rk, crypto.SHA256, dgst[:])
+	if err != nil {
+		return "", err
+	}
+
+	frm := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {uns + "." + enc.EncodeToString(sig)},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sa.TokenURI, strings.NewReader(frm.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response from token endpoint: %s", res.Status)
+	}
+
+	var tr struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tr); err != nil {
+		return "", err
+	}
+
+	return tr.AccessToken, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	snapshotCatalog  bool
+	snapshotKeep     = 0
+	snapshotsIndices = []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				primitive.E{
+					Key:   "snapshotId",
+					Value: 1,
+				},
+				primitive.E{
+					Key:   "id",
+					Value: 1,
+				},
+			},
+		},
+		{
+			Keys: bson.D{
+				primitive.E{
+					Key:   "takenAt",
+					Value: -1,
+				},
+			},
+		},
+	}
+)
+
+// snapshot summarizes a single copy of the catalog
+type snapshot struct {
+	ID      primitive.ObjectID `bson:"_id"`
+	TakenAt time.Time          `bson:"takenAt"`
+	Songs   int                `bson:"songs"`
+}
+
+// listSnapshots returns the snapshots taken, most recent first
+func listSnapshots(ctx context.Context, c *mongo.Client) []snapshot {
+	cur, err := c.Database(karaokeDB).Collection(snapshotsCollection).Aggregate(ctx, mongo.Pipeline{
+		bson.D{primitive.E{
+			Key: "$group",
+			Value: bson.M{
+				"_id":     "$snapshotId",
+				"takenAt": bson.M{"$first": "$takenAt"},
+				"songs":   bson.M{"$sum": 1},
+			},
+		}},
+		bson.D{primitive.E{
+			Key:   "$sort",
+			Value: bson.M{"takenAt": -1},
+		}},
+	})
+	if err != nil {
+		fmt.Printf("Error listing snapshots: %v", err)
+		panic(err)
+	}
+
+	var snps []snapshot
+	if err = cur.All(ctx, &snps); err != nil {
+		fmt.Printf("Error reading snapshots: %v", err)
+		panic(err)
+	}
+
+	return snps
+}
+
+// pruneSnapshots removes all but the most recent keep snapshots
+func pruneSnapshots(ctx context.Context, c *mongo.Client, keep int) {
+	snps := listSnapshots(ctx, c)
+	if len(snps) <= keep {
+		return
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(snps)-keep)
+	for _, snp := range snps[keep:] {
+		ids = append(ids, snp.ID)
+	}
+
+	res, err := c.Database(karaokeDB).Collection(snapshotsCollection).DeleteMany(
+		ctx,
+		bson.M{"snapshotId": bson.M{"$in": ids}})
+	if err != nil {
+		fmt.Printf("Error pruning snapshots: %v", err)
+		panic(err)
+	}
+
+	fmt.Printf("Pruned %d snapshots (%d songs)\n", len(ids), res.DeletedCount)
+}
+
+// snapshotAt returns the most recent snapshot taken before t
+func snapshotAt(ctx context.Context, c *mongo.Client, t time.Time) (snapshot, bool) {
+	var snp struct {
+		SnapshotID primitive.ObjectID `bson:"snapshotId"`
+		TakenAt    time.Time          `bson:"takenAt"`
+	}
+
+	err := c.Database(karaokeDB).Collection(snapshotsCollection).FindOne(
+		ctx,
+		bson.M{"takenAt": bson.M{"$lt": t}},
+		options.FindOne().SetSort(bson.M{"takenAt": -1})).Decode(&snp)
+	if err == mongo.ErrNoDocuments {
+		return snapshot{}, false
+	}
+
+	if err != nil {
+		fmt.Printf("Error finding snapshot before %s: %v", t.Format(time.RFC3339), err)
+		panic(err)
+	}
+
+	return snapshot{ID: snp.SnapshotID, TakenAt: snp.TakenAt}, true
+}
+
+// snapshotSongs returns a cursor over the songs in a snapshot ordered by ID
+func snapshotSongs(ctx context.Context, c *mongo.Client, id primitive.ObjectID) *mongo.Cursor {
+	cur, err := c.Database(karaokeDB).Collection(snapshotsCollection).Find(
+		ctx,
+		bson.M{"snapshotId": id},
+		options.Find().SetBatchSize(exportBatchSize).SetSort(bson.M{"id": 1}))
+	if err != nil {
+		fmt.Printf("Error retrieving snapshot (%s): %v", id.Hex(), err)
+		panic(err)
+	}
+
+	return cur
+}
+
+// takeSnapshot copies the live catalog into the snapshots collection,
+// stamping each song with the snapshot ID and time
+func takeSnapshot(ctx context.Context, c *mongo.Client) {
+	db := c.Database(karaokeDB)
+	if _, err := db.Collection(snapshotsCollection).Indexes().CreateMany(ctx, snapshotsIndices); err != nil {
+		fmt.Printf("Error creating snapshot indices: %v", err)
+		panic(err)
+	}
+
+	id := primitive.NewObjectID()
+	cur, err := db.Collection(songsCollection).Aggregate(ctx, mongo.Pipeline{
+		bson.D{primitive.E{
+			Key:   "$project",
+			Value: bson.M{"_id": 0},
+		}},
+		bson.D{primitive.E{
+			Key: "$addFields",
+			Value: bson.M{
+				"snapshotId": id,
+				"takenAt":    time.Now().UTC(),
+			},
+		}},
+		bson.D{primitive.E{
+			Key:   "$merge",
+			Value: bson.M{"into": snapshotsCollection},
+		}},
+	})
+	if err != nil {
+		fmt.Printf("Error taking snapshot: %v", err)
+		panic(err)
+	}
+	cur.Close(ctx)
+
+	fmt.Printf("Took catalog snapshot (%s)\n", id.Hex())
+}
+
+func runSnapshots(args []string) int {
+	fs := flag.NewFlagSet("snapshots", flag.ExitOnError)
+	at := fs.String("at", "", "print the catalog as it was at the end of this `date` (CSV)")
+	keep := fs.Int("prune", 0, "remove all but the most recent `n` snapshots")
+	fs.Parse(args)
+
+	// the date includes snapshots taken at any time that day in the local
+	// time zone
+	var d time.Time
+	if *at != "" {
+		var ok bool
+		if d, ok = parseDate(*at); !ok {
+			fmt.Printf("Error: unable to parse date (%s)\n", *at)
+			fs.Usage()
+			return exitConfig
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	// remove old snapshots
+	if *keep > 0 {
+		pruneSnapshots(ctx, c, *keep)
+		return exitOK
+	}
+
+	// list the snapshots
+	if *at == "" {
+		for _, snp := range listSnapshots(ctx, c) {
+			fmt.Printf("%s\t%s\t%d songs\n", snp.ID.Hex(), snp.TakenAt.In(timeZone).Format(time.RFC3339), snp.Songs)
+		}
+
+		return exitOK
+	}
+
+	// print the catalog as of the requested date
+	snp, ok := snapshotAt(ctx, c, startOfDay(d).AddDate(0, 0, 1))
+	if !ok {
+		fmt.Printf("No snapshot was taken on or before %s\n", *at)
+		return exitOK
+	}
+
+	if _, err := writeSongs(ctx, snapshotSongs(ctx, c, snp.ID), newCSVSongWriter(os.Stdout)); err != nil {
+		fmt.Printf("Error writing snapshot (%s): %v", snp.ID.Hex(), err)
+		panic(err)
+	}
+
+	return exitOK
+}
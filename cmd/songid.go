@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	// songIDTypes are the BSON types song IDs are stored as
+	songIDTypes = bson.A{"int", "long", "string"}
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// SongID identifies a song in the provider's catalog; numeric IDs (such as
+// KaraFun's) are stored as numbers and alphanumeric or UUID IDs as strings
+type SongID string
+
+// parseSongID validates a song ID, normalizing UUIDs to lower case
+func parseSongID(s string) (SongID, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", fmt.Errorf("song id is empty")
+	}
+
+	if uuidPattern.MatchString(s) {
+		s = strings.ToLower(s)
+	}
+
+	return SongID(s), nil
+}
+
+// number returns the ID as an integer when it is numeric
+func (id SongID) number() (int64, bool) {
+	n, err := strconv.ParseInt(string(id), 10, 64)
+	return n, err == nil && strconv.FormatInt(n, 10) == string(id)
+}
+
+// Less orders numeric IDs by value before other IDs, matching how MongoDB
+// sorts numbers before strings
+func (id SongID) Less(o SongID) bool {
+	n, nok := id.number()
+	m, mok := o.number()
+	switch {
+	case nok && mok:
+		return n < m
+	case nok != mok:
+		return nok
+	default:
+		return id < o
+	}
+}
+
+// MarshalJSON writes numeric IDs as JSON numbers for hooks and webhooks
+func (id SongID) MarshalJSON() ([]byte, error) {
+	if n, ok := id.number(); ok {
+		return []byte(strconv.FormatInt(n, 10)), nil
+	}
+
+	return json.Marshal(string(id))
+}
+
+func (id *SongID) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*id = SongID(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("song id must be a string or number: %s", b)
+	}
+
+	*id = SongID(n.String())
+	return nil
+}
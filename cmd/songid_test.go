@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseSongID(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want SongID
+		err  bool
+	}{
+		{in: "49375", want: "49375"},
+		{in: " kf-49375 ", want: "kf-49375"},
+		{in: "0F8FAD5B-D9CB-469F-A165-70867728950E", want: "0f8fad5b-d9cb-469f-a165-70867728950e"},
+		{in: "ABC-Not-A-UUID", want: "ABC-Not-A-UUID"},
+		{in: "", err: true},
+		{in: "  ", err: true},
+	} {
+		got, err := parseSongID(tc.in)
+		if tc.err {
+			if err == nil {
+				t.Errorf("parseSongID(%q) accepted", tc.in)
+			}
+			continue
+		}
+
+		if err != nil || got != tc.want {
+			t.Errorf("parseSongID(%q) = %q, %v, want %q", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestSongIDLess(t *testing.T) {
+	ids := []SongID{"kf-2", "100", "9", "0f8fad5b-d9cb-469f-a165-70867728950e", "007", "9876543210", "kf-10"}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Less(ids[j]) })
+
+	// numbers sort by value before strings; a zero padded ID is a string
+	want := []SongID{"9", "100", "9876543210", "007", "0f8fad5b-d9cb-469f-a165-70867728950e", "kf-10", "kf-2"}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("sorted ids = %q, want %q", ids, want)
+		}
+	}
+}
+
+func TestSongIDJSON(t *testing.T) {
+	for _, tc := range []struct {
+		id   SongID
+		json string
+	}{
+		{"49375", `49375`},
+		{"007", `"007"`},
+		{"kf-49375", `"kf-49375"`},
+	} {
+		b, err := json.Marshal(tc.id)
+		if err != nil || string(b) != tc.json {
+			t.Errorf("json.Marshal(%q) = %s, %v, want %s", tc.id, b, err, tc.json)
+		}
+
+		var id SongID
+		if err := json.Unmarshal(b, &id); err != nil || id != tc.id {
+			t.Errorf("json.Unmarshal(%s) = %q, %v, want %q", b, id, err, tc.id)
+		}
+	}
+
+	var id SongID
+	if err := json.Unmarshal([]byte(`true`), &id); err == nil {
+		t.Errorf("json.Unmarshal(true) accepted")
+	}
+}
+
+func TestSongIDBSON(t *testing.T) {
+	for _, tc := range []struct {
+		id   SongID
+		want any
+	}{
+		{"49375", int32(49375)},
+		{"9876543210", int64(9876543210)},
+		{"007", "007"},
+		{"kf-49375", "kf-49375"},
+	} {
+		b, err := bson.MarshalWithRegistry(songsRegistry, bson.M{"id": tc.id})
+		if err != nil {
+			t.Fatalf("encoding %q: %v", tc.id, err)
+		}
+
+		var raw bson.M
+		if err := bson.Unmarshal(b, &raw); err != nil || raw["id"] != tc.want {
+			t.Errorf("%q stored as %#v, want %#v", tc.id, raw["id"], tc.want)
+		}
+
+		var doc struct {
+			ID SongID `bson:"id"`
+		}
+		if err := bson.UnmarshalWithRegistry(songsRegistry, b, &doc); err != nil || doc.ID != tc.id {
+			t.Errorf("%q decoded as %q, %v", tc.id, doc.ID, err)
+		}
+	}
+}
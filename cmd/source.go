@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+)
+
+// utf8BOM is the byte order mark spreadsheet tools may start an export with
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// source provides the raw catalog records, in the KaraFun export layout
+// with the header first, to the import pipeline
+type source interface {
+	fmt.Stringer
+	Records() ([][]string, error)
+}
+
+// csvSource reads records from a semicolon separated KaraFun export
+type csvSource struct {
+	path string
+}
+
+func (s csvSource) String() string {
+	return s.path
+}
+
+func (s csvSource) Records() ([][]string, error) {
+	cf, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer cf.Close()
+
+	return readCSV(cf)
+}
+
+// readCSV reads semicolon separated records, skipping a byte order mark;
+// records may have any number of fields so short records are reported and
+// skipped on their own instead of failing the whole source
+func readCSV(r io.Reader) ([][]string, error) {
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(b, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+
+	rdr := csv.NewReader(br)
+	rdr.Comma = ';'
+	rdr.FieldsPerRecord = -1
+
+	return rdr.ReadAll()
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// localFields are maintained outside of imports and are carried over
+	// from the live catalog into the staging collection
+	localFields = []string{"advisory", "difficulty", "embedding", "embeddingHash", "preview", "status", "statusChangedAt", "tags"}
+	// searchUnsupportedCodes are server errors listing search indices
+	// returns on deployments without Atlas Search
+	searchUnsupportedCodes = []int{
+		115,   // CommandNotSupported
+		31082, // SearchNotEnabled
+		40324, // UnrecognizedPipelineStage
+	}
+	staging bool
+)
+
+// searchIndex is an Atlas Search or Atlas Vector Search index of a
+// collection
+type searchIndex struct {
+	Name             string `bson:"name"`
+	Type             string `bson:"type"`
+	LatestDefinition bson.M `bson:"latestDefinition"`
+}
+
+// prepareStagingCollection drops any leftover staging collection and returns
+// the IDs of the songs currently in the live catalog
+func prepareStagingCollection(ctx context.Context, c *mongo.Client) map[SongID]bool {
+	db := c.Database(karaokeDB)
+
+	// remove leftovers from a previous interrupted or failed import
+	if err := db.Collection(stagingCollection).Drop(ctx); err != nil {
+		fmt.Printf("Error dropping staging collection (%s): %v", stagingCollection, err)
+		panic(err)
+	}
+
+	return liveSongIDs(ctx, c)
+}
+
+// liveSongIDs returns the IDs of the songs in the live catalog
+func liveSongIDs(ctx context.Context, c *mongo.Client) map[SongID]bool {
+	cur, err := c.Database(karaokeDB).Collection(songsCollection).Find(
+		ctx,
+		bson.D{},
+		options.Find().SetProjection(bson.M{"_id": 0, "id": 1}))
+	if err != nil {
+		fmt.Printf("Error retrieving existing songs: %v", err)
+		panic(err)
+	}
+
+	var ids []struct {
+		ID SongID `bson:"id"`
+	}
+	if err = cur.All(ctx, &ids); err != nil {
+		fmt.Printf("Error reading existing songs: %v", err)
+		panic(err)
+	}
+
+	lids := make(map[SongID]bool, len(ids))
+	for _, id := range ids {
+		lids[id.ID] = true
+	}
+
+	return lids
+}
+
+// swapStagingCollection validates the staging collection holds one document
+// per distinct staged song, carries over the live catalog's local fields and
+// songs missing from the import, and then atomically renames it over the
+// live collection
+func swapStagingCollection(ctx context.Context, c *mongo.Client, sngs []Song) {
+	ids := make(map[SongID]bool, len(sngs))
+	for _, sng := range sngs {
+		ids[sng.ID] = true
+	}
+
+	sclctn := c.Database(karaokeDB).Collection(stagingCollection)
+	n, err := sclctn.CountDocuments(ctx, bson.D{})
+	if err != nil {
+		fmt.Printf("Error counting staged songs: %v", err)
+		panic(err)
+	}
+
+	if n != int64(len(ids)) {
+		err := fmt.Errorf("expected %d songs in %s, found %d", len(ids), stagingCollection, n)
+		fmt.Printf("Error validating staged songs: %v", err)
+		panic(err)
+	}
+
+	mergeLiveCatalog(ctx, c)
+	updateStatuses(ctx, sclctn, sngs)
+
+	// dropping the live collection drops its search indices with it, so
+	// they are recreated on the swapped collection
+	sidxs, err := searchIndices(ctx, c, songsCollection)
+	if err != nil {
+		fmt.Printf("Error retrieving Atlas Search indices of %s: %v", songsCollection, err)
+		panic(err)
+	}
+
+	if n, err = sclctn.CountDocuments(ctx, bson.D{}); err != nil {
+		fmt.Printf("Error counting staged songs: %v", err)
+		panic(err)
+	}
+
+	cmd := bson.D{
+		primitive.E{
+			Key:   "renameCollection",
+			Value: karaokeDB + "." + stagingCollection,
+		},
+		primitive.E{
+			Key:   "to",
+			Value: karaokeDB + "." + songsCollection,
+		},
+		primitive.E{
+			Key:   "dropTarget",
+			Value: true,
+		},
+	}
+
+	if err := c.Database("admin").RunCommand(ctx, cmd).Err(); err != nil {
+		fmt.Printf("Error swapping staging collection into place: %v", err)
+		panic(err)
+	}
+
+	restoreSearchIndices(ctx, c, sidxs)
+
+	fmt.Printf("Swapped %s into place as %s (%d songs)\n", stagingCollection, songsCollection, n)
+}
+
+// mergeLiveCatalog copies fields that imports never set from the live
+// catalog onto the matching staged songs and copies live songs that are not
+// in the import into the staging collection
+func mergeLiveCatalog(ctx context.Context, c *mongo.Client) {
+	set := make(bson.M, len(localFields)+len(protectedFields))
+	for _, f := range localFields {
+		set[f] = "$$new." + f
+	}
+
+	// protected fields keep their live values too
+	for f := range protectedFields {
+		set[f] = "$$new." + f
+	}
+
+	cur, err := c.Database(karaokeDB).Collection(songsCollection).Aggregate(ctx, mongo.Pipeline{
+		bson.D{primitive.E{
+			Key:   "$project",
+			Value: bson.M{"_id": 0},
+		}},
+		bson.D{primitive.E{
+			Key: "$merge",
+			Value: bson.M{
+				"into": stagingCollection,
+				"on":   "id",
+				"whenMatched": bson.A{
+					bson.M{"$set": set},
+				},
+				"whenNotMatched": "insert",
+			},
+		}},
+	})
+	if err != nil {
+		fmt.Printf("Error merging live catalog into staging collection: %v", err)
+		panic(err)
+	}
+	cur.Close(ctx)
+}
+
+// searchIndices returns the Atlas Search indices of the collection, which
+// deployments without Atlas Search have none of
+func searchIndices(ctx context.Context, c *mongo.Client, name string) ([]searchIndex, error) {
+	cur, err := c.Database(karaokeDB).Collection(name).Aggregate(ctx, mongo.Pipeline{
+		bson.D{primitive.E{
+			Key:   "$listSearchIndexes",
+			Value: bson.M{},
+		}},
+	})
+
+	var se mongo.ServerError
+	if errors.As(err, &se) {
+		for _, code := range searchUnsupportedCodes {
+			if se.HasErrorCode(code) {
+				return nil, nil
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var sidxs []searchIndex
+	if err = cur.All(ctx, &sidxs); err != nil {
+		return nil, err
+	}
+
+	return sidxs, nil
+}
+
+// restoreSearchIndices recreates the search indices the live catalog had
+// before the swap and verifies the swapped collection has each of them
+func restoreSearchIndices(ctx context.Context, c *mongo.Client, sidxs []searchIndex) {
+	if len(sidxs) == 0 {
+		return
+	}
+
+	idxs := make(bson.A, 0, len(sidxs))
+	for _, sidx := range sidxs {
+		idx := bson.M{"name": sidx.Name, "definition": sidx.LatestDefinition}
+		if sidx.Type != "" {
+			idx["type"] = sidx.Type
+		}
+
+		idxs = append(idxs, idx)
+	}
+
+	cmd := bson.D{
+		primitive.E{
+			Key:   "createSearchIndexes",
+			Value: songsCollection,
+		},
+		primitive.E{
+			Key:   "indexes",
+			Value: idxs,
+		},
+	}
+
+	if err := c.Database(karaokeDB).RunCommand(ctx, cmd).Err(); err != nil {
+		fmt.Printf("Error recreating Atlas Search indices on %s (run embed and import -atlas-search to restore them): %v", songsCollection, err)
+		panic(err)
+	}
+
+	have, err := searchIndices(ctx, c, songsCollection)
+	if err != nil {
+		fmt.Printf("Error retrieving Atlas Search indices of %s: %v", songsCollection, err)
+		panic(err)
+	}
+
+	found := make(map[string]bool, len(have))
+	for _, sidx := range have {
+		found[sidx.Name] = true
+	}
+
+	for _, sidx := range sidxs {
+		if !found[sidx.Name] {
+			err := fmt.Errorf("%s is missing from %s after the swap", sidx.Name, songsCollection)
+			fmt.Printf("Error verifying Atlas Search indices (run embed and import -atlas-search to restore them): %v", err)
+			panic(err)
+		}
+
+		fmt.Printf("Recreated Atlas Search index (%s) on %s\n", sidx.Name, songsCollection)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// histogramWidth is the width in characters of the longest histogram bar
+const histogramWidth = 40
+
+// bucket is a value and the number of songs that have it
+type bucket struct {
+	Value any `bson:"_id" json:"value"`
+	Count int `bson:"count" json:"count"`
+}
+
+// catalogStats are the distributions of the songs in the catalog
+type catalogStats struct {
+	Songs     int      `json:"songs"`
+	Duets     int      `json:"duets"`
+	Explicit  int      `json:"explicit"`
+	Decades   []bucket `json:"decades"`
+	Languages []bucket `json:"languages"`
+	Styles    []bucket `json:"styles"`
+	Moods     []bucket `json:"moods"`
+}
+
+// countBy groups songs by an expression, largest groups first unless the
+// groups are sorted by value
+func countBy(expr any, byValue bool) mongo.Pipeline {
+	srt := bson.D{primitive.E{Key: "count", Value: -1}, primitive.E{Key: "_id", Value: 1}}
+	if byValue {
+		srt = bson.D{primitive.E{Key: "_id", Value: 1}}
+	}
+
+	return mongo.Pipeline{
+		bson.D{primitive.E{
+			Key:   "$group",
+			Value: bson.M{"_id": expr, "count": bson.M{"$sum": 1}},
+		}},
+		bson.D{primitive.E{Key: "$sort", Value: srt}},
+	}
+}
+
+// unwoundCountBy counts songs by each element of a list field
+func unwoundCountBy(field string) mongo.Pipeline {
+	return append(mongo.Pipeline{
+		bson.D{primitive.E{Key: "$unwind", Value: "$" + field}},
+	}, countBy("$"+field, false)...)
+}
+
+// printHistogram prints buckets as a table with bars scaled to the largest
+func printHistogram(title string, bkts []bucket, total int) {
+	fmt.Printf("\n%s\n", title)
+
+	mx, wd := 0, 0
+	for _, b := range bkts {
+		if b.Count > mx {
+			mx = b.Count
+		}
+		if l := len(fmt.Sprint(b.Value)); l > wd {
+			wd = l
+		}
+	}
+
+	for _, b := range bkts {
+		bar := strings.Repeat("#", b.Count*histogramWidth/mx)
+		fmt.Printf("  %-*v %7d %5.1f%% %s\n", wd, b.Value, b.Count, percent(b.Count, total), bar)
+	}
+}
+
+// percent returns n as a percentage of total
+func percent(n int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(n) * 100 / float64(total)
+}
+
+func runStats(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	filter := fs.String("filter", "", "MongoDB query `filter` (extended JSON) selecting the songs to describe (default all songs)")
+	q := fs.String("q", "", "`query` selecting the songs to describe, e.g. language:french year:1960..1969")
+	asJSON := fs.Bool("json", false, "print the statistics as JSON instead of tables")
+	top := fs.Int("top", 20, "number of languages and styles to show")
+	fs.Parse(args)
+
+	if *top < 1 {
+		fmt.Println("Error: -top must be at least 1")
+		fs.Usage()
+		return exitConfig
+	}
+
+	qry := bson.M{}
+	if *filter != "" || *q != "" {
+		var err error
+		if qry, err = songsFilter("", *filter, *q); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			fs.Usage()
+			return exitConfig
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	lmt := bson.D{primitive.E{Key: "$limit", Value: *top}}
+	cur, err := c.Database(karaokeDB).Collection(songsCollection).Aggregate(ctx, mongo.Pipeline{
+		bson.D{primitive.E{Key: "$match", Value: qry}},
+		bson.D{primitive.E{
+			Key: "$facet",
+			Value: bson.M{
+				"totals": countBy(nil, true),
+				"duets": append(mongo.Pipeline{
+					bson.D{primitive.E{Key: "$match", Value: bson.M{"duo": true}}},
+				}, countBy(nil, true)...),
+				"explicit": append(mongo.Pipeline{
+					bson.D{primitive.E{Key: "$match", Value: bson.M{"explicit": true}}},
+				}, countBy(nil, true)...),
+				"decades": append(mongo.Pipeline{
+					bson.D{primitive.E{Key: "$match", Value: bson.M{"year": bson.M{"$gt": 0}}}},
+				}, countBy(bson.M{"$subtract": bson.A{"$year", bson.M{"$mod": bson.A{"$year", 10}}}}, true)...),
+				"languages": append(unwoundCountBy("languages"), lmt),
+				"styles":    append(unwoundCountBy("styles"), lmt),
+				"moods":     countBy("$mood", false),
+			},
+		}},
+	})
+	if err != nil {
+		fmt.Printf("Error aggregating catalog statistics: %v", err)
+		panic(err)
+	}
+
+	var res []struct {
+		Totals    []bucket `bson:"totals"`
+		Duets     []bucket `bson:"duets"`
+		Explicit  []bucket `bson:"explicit"`
+		Decades   []bucket `bson:"decades"`
+		Languages []bucket `bson:"languages"`
+		Styles    []bucket `bson:"styles"`
+		Moods     []bucket `bson:"moods"`
+	}
+	if err = cur.All(ctx, &res); err != nil {
+		fmt.Printf("Error reading catalog statistics: %v", err)
+		panic(err)
+	}
+
+	// the totals, duets, and explicit facets hold at most one bucket
+	first := func(bkts []bucket) int {
+		if len(bkts) == 0 {
+			return 0
+		}
+
+		return bkts[0].Count
+	}
+
+	r := res[0]
+	st := catalogStats{
+		Songs:     first(r.Totals),
+		Duets:     first(r.Duets),
+		Explicit:  first(r.Explicit),
+		Decades:   r.Decades,
+		Languages: r.Languages,
+		Styles:    r.Styles,
+		Moods:     r.Moods,
+	}
+
+	if *asJSON {
+		b, err := json.Marshal(st)
+		if err != nil {
+			fmt.Printf("Error encoding catalog statistics: %v", err)
+			panic(err)
+		}
+
+		fmt.Println(string(b))
+		return exitOK
+	}
+
+	fmt.Printf("Songs: %d\n", st.Songs)
+	fmt.Printf("Duets: %d (%.1f%%)\n", st.Duets, percent(st.Duets, st.Songs))
+	fmt.Printf("Explicit: %d (%.1f%%)\n", st.Explicit, percent(st.Explicit, st.Songs))
+
+	for i, b := range st.Decades {
+		st.Decades[i].Value = fmt.Sprintf("%vs", b.Value)
+	}
+	for i, b := range st.Moods {
+		if b.Value == nil || b.Value == "" {
+			st.Moods[i].Value = "unclassified"
+		}
+	}
+	printHistogram("Songs per decade", st.Decades, st.Songs)
+	printHistogram(fmt.Sprintf("Top %d languages", *top), st.Languages, st.Songs)
+	printHistogram(fmt.Sprintf("Top %d styles", *top), st.Styles, st.Songs)
+	printHistogram("Moods", st.Moods, st.Songs)
+
+	return exitOK
+}
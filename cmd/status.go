@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	statusActive      = "active"
+	statusRemoved     = "removed"
+	statusUnavailable = "unavailable"
+)
+
+var (
+	// statuses are the availability states a song can be in
+	statuses = []string{statusActive, statusUnavailable, statusRemoved}
+	// supplementary imports add to the catalog rather than being the full
+	// catalog of their source, so songs they leave out are not pruned
+	supplementary bool
+)
+
+// updateStatuses activates the imported songs, unless an admin removed them,
+// and marks active songs last imported from the same source that were not
+// imported this time as unavailable; supplementary imports only activate
+func updateStatuses(ctx context.Context, clctn *mongo.Collection, sngs []Song) {
+	ids := make([]SongID, 0, len(sngs))
+	for _, sng := range sngs {
+		ids = append(ids, sng.ID)
+	}
+
+	now := time.Now().UTC()
+	act, err := clctn.UpdateMany(
+		ctx,
+		bson.M{
+			"id":     bson.M{"$in": ids},
+			"status": bson.M{"$nin": bson.A{statusActive, statusRemoved}},
+		},
+		bson.M{"$set": bson.M{"status": statusActive, "statusChangedAt": now}})
+	if err != nil {
+		fmt.Printf("Error activating imported songs: %v", err)
+		panic(err)
+	}
+
+	if supplementary {
+		fmt.Printf("Availability updated: %d songs became active (supplementary import, none pruned)\n", act.ModifiedCount)
+		return
+	}
+
+	// songs from other sources are left to their own imports
+	unv, err := clctn.UpdateMany(
+		ctx,
+		bson.M{
+			"id":     bson.M{"$nin": ids},
+			"source": sourceName,
+			"status": bson.M{"$nin": bson.A{statusUnavailable, statusRemoved}},
+		},
+		bson.M{"$set": bson.M{"status": statusUnavailable, "statusChangedAt": now}})
+	if err != nil {
+		fmt.Printf("Error marking missing songs unavailable: %v", err)
+		panic(err)
+	}
+
+	summary.Pruned += int(unv.ModifiedCount)
+	fmt.Printf("Availability updated: %d songs became active and %d songs became unavailable\n", act.ModifiedCount, unv.ModifiedCount)
+}
+
+func runStatus(args []string) int {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	ids := fs.String("ids", "", "comma separated song `ids` to update")
+	filter := fs.String("filter", "", "MongoDB query `filter` (extended JSON) selecting songs to update")
+	q := fs.String("q", "", "`query` selecting songs to update, e.g. artist:\"queen\" year:1975..1985 -explicit")
+	set := fs.String("set", "", "the availability `status` to set ("+strings.Join(statuses, ", ")+")")
+	fs.Parse(args)
+
+	valid := false
+	for _, st := range statuses {
+		valid = valid || *set == st
+	}
+
+	if !valid {
+		fmt.Printf("Error: status must be one of %s\n", strings.Join(statuses, ", "))
+		fs.Usage()
+		return exitConfig
+	}
+
+	qry, err := songsFilter(*ids, *filter, *q)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fs.Usage()
+		return exitConfig
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	// only stamp songs whose status actually changes
+	res, err := c.Database(karaokeDB).Collection(songsCollection).UpdateMany(
+		ctx,
+		bson.M{"$and": bson.A{qry, bson.M{"status": bson.M{"$ne": *set}}}},
+		bson.M{"$set": bson.M{"status": *set, "statusChangedAt": time.Now().UTC()}})
+	if err != nil {
+		fmt.Printf("Error updating statuses: %v", err)
+		panic(err)
+	}
+
+	fmt.Printf("Statuses updated: %d songs changed to %s\n", res.ModifiedCount, *set)
+
+	return exitOK
+}
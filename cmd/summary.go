@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// interruptedError is the summary error of an import stopped before it
+// completed
+const interruptedError = "import interrupted before completion"
+
+var (
+	summary     = importSummary{Changes: []songChanges{}, Errors: []string{}}
+	summaryPath string
+)
+
+// importSummary is the machine-readable result of an import run
+type importSummary struct {
+	Inserted         int                 `bson:"inserted" json:"inserted"`
+	Updated          int                 `bson:"updated" json:"updated"`
+	Unchanged        int                 `bson:"unchanged" json:"unchanged"`
+	Skipped          int                 `bson:"skipped" json:"skipped"`
+	Pruned           int                 `bson:"pruned" json:"pruned"`
+	Conflicts        int                 `bson:"conflicts" json:"conflicts"`
+	Duplicates       []possibleDuplicate `bson:"duplicates,omitempty" json:"duplicates,omitempty"`
+	Changes          []songChanges       `bson:"changes" json:"changes"`
+	ChangesTruncated int                 `bson:"changesTruncated" json:"changesTruncated"`
+	Errors           []string            `bson:"errors" json:"errors"`
+	DurationMs       int64               `bson:"durationMs" json:"durationMs"`
+}
+
+// importRun is the record of an import kept in the import runs collection
+type importRun struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	StartedAt     time.Time          `bson:"startedAt"`
+	Source        string             `bson:"source"`
+	SourceHash    string             `bson:"sourceHash"`
+	ETag          string             `bson:"etag,omitempty"`
+	LastModified  string             `bson:"lastModified,omitempty"`
+	Staging       bool               `bson:"staging"`
+	importSummary `bson:",inline"`
+}
+
+// skip records a song or record that was not imported because of an error
+func (s *importSummary) skip(format string, a ...any) {
+	s.Skipped++
+	s.Errors = append(s.Errors, fmt.Sprintf(format, a...))
+}
+
+// writeSummary writes a summary as JSON to a file, or to stdout for "-"
+func writeSummary(path string, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		fmt.Printf("Error encoding summary: %v", err)
+		panic(err)
+	}
+
+	if path == "-" {
+		fmt.Println(string(b))
+		return
+	}
+
+	if err := os.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		fmt.Printf("Error writing summary (%s): %v", path, err)
+		panic(err)
+	}
+}
+
+// enrichmentSummary is the machine-readable result of an enrichment run
+// (embed or preview), including the state its circuit breaker ended in
+type enrichmentSummary struct {
+	Enriched   int          `json:"enriched"`
+	Failed     int          `json:"failed"`
+	Skipped    int          `json:"skipped"`
+	Breaker    breakerState `json:"breaker"`
+	DurationMs int64        `json:"durationMs"`
+}
+
+// reportEnrichment writes the summary of an enrichment run to the path, when
+// set, and pushes its metrics to the configured Pushgateway
+func reportEnrichment(cmd string, path string, s enrichmentSummary, start time.Time) {
+	s.DurationMs = time.Since(start).Milliseconds()
+	if path != "" {
+		writeSummary(path, s)
+	}
+
+	pushEnrichmentMetrics(cmd, s, start)
+}
+
+// recordImportRun stores the summary of an import, including the changes to
+// existing songs, and the sync state of its source; failures are printed and
+// otherwise ignored
+func recordImportRun(c *mongo.Client, start time.Time, src source, sngs []Song) {
+	ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+	defer cancel()
+
+	run := importRun{
+		ID:            importRunID,
+		StartedAt:     start.UTC(),
+		Source:        src.String(),
+		SourceHash:    sourceHash,
+		Staging:       staging,
+		importSummary: summary,
+	}
+	run.DurationMs = time.Since(start).Milliseconds()
+	if ks, ok := src.(*karafunSource); ok {
+		run.ETag, run.LastModified = ks.etag, ks.lastModified
+	}
+
+	if _, err := c.Database(karaokeDB).Collection(importRunsCollection).InsertOne(ctx, run); err != nil {
+		fmt.Printf("Error recording import run: %v\n", err)
+	}
+
+	recordSyncState(ctx, c, run, sngs)
+}
+
+// lastImportRun returns the most recent completed import from a source, or
+// an empty run when there is none
+func lastImportRun(src source) importRun {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	var run importRun
+	err := c.Database(karaokeDB).Collection(importRunsCollection).FindOne(
+		ctx,
+		bson.M{"source": src.String(), "errors": bson.M{"$ne": interruptedError}},
+		options.FindOne().SetSort(bson.M{"startedAt": -1})).Decode(&run)
+	if err != nil && err != mongo.ErrNoDocuments {
+		fmt.Printf("Error retrieving the last import run (%s): %v", src, err)
+		panic(err)
+	}
+
+	return run
+}
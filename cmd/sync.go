@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// syncState is what is known about syncing the catalog from a source, kept
+// in the sync state collection so the next sync can ask for changes only
+type syncState struct {
+	Source          string             `bson:"_id" json:"source"`
+	LastSyncAt      time.Time          `bson:"lastSyncAt" json:"lastSyncAt"`
+	LastRunID       primitive.ObjectID `bson:"lastRunID,omitempty" json:"lastRunID,omitempty"`
+	LastError       string             `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	LastSuccessAt   time.Time          `bson:"lastSuccessAt,omitempty" json:"lastSuccessAt,omitempty"`
+	SourceHash      string             `bson:"sourceHash,omitempty" json:"sourceHash,omitempty"`
+	ETag            string             `bson:"etag,omitempty" json:"etag,omitempty"`
+	LastModified    string             `bson:"lastModified,omitempty" json:"lastModified,omitempty"`
+	LatestDateAdded time.Time          `bson:"latestDateAdded,omitempty" json:"latestDateAdded,omitempty"`
+	Songs           int                `bson:"songs" json:"songs"`
+}
+
+// latestDateAdded returns the most recent date a provider added one of the
+// songs, the point an incremental feed would be read from next time
+func latestDateAdded(sngs []Song) time.Time {
+	var lt time.Time
+	for _, sng := range sngs {
+		if sng.DateAdded.After(lt) {
+			lt = sng.DateAdded
+		}
+	}
+
+	return lt
+}
+
+// recordSyncState updates the sync state of the source an import read; an
+// interrupted import only records the attempt, and failures are printed and
+// otherwise ignored
+func recordSyncState(ctx context.Context, c *mongo.Client, run importRun, sngs []Song) {
+	set := bson.M{"lastSyncAt": run.StartedAt, "lastRunID": run.ID}
+	unset := bson.M{}
+	if len(run.Errors) > 0 && run.Errors[len(run.Errors)-1] == interruptedError {
+		set["lastError"] = interruptedError
+	} else {
+		unset["lastError"] = ""
+		set["lastSuccessAt"] = run.StartedAt
+		set["sourceHash"] = run.SourceHash
+		set["etag"] = run.ETag
+		set["lastModified"] = run.LastModified
+		set["latestDateAdded"] = latestDateAdded(sngs)
+		set["songs"] = len(sngs)
+	}
+
+	upd := bson.M{"$set": set}
+	if len(unset) > 0 {
+		upd["$unset"] = unset
+	}
+
+	if _, err := c.Database(karaokeDB).Collection(syncStateCollection).UpdateOne(
+		ctx,
+		bson.M{"_id": run.Source},
+		upd,
+		options.Update().SetUpsert(true)); err != nil {
+		fmt.Printf("Error recording sync state (%s): %v\n", run.Source, err)
+	}
+}
+
+// recordUnchangedSync records a sync that found the source unchanged since
+// the last import; failures are printed and otherwise ignored
+func recordUnchangedSync(src source, at time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	if _, err := c.Database(karaokeDB).Collection(syncStateCollection).UpdateOne(
+		ctx,
+		bson.M{"_id": src.String()},
+		bson.M{
+			"$set":   bson.M{"lastSyncAt": at.UTC(), "lastSuccessAt": at.UTC()},
+			"$unset": bson.M{"lastError": ""},
+		},
+		options.Update().SetUpsert(true)); err != nil {
+		fmt.Printf("Error recording sync state (%s): %v\n", src, err)
+	}
+}
+
+// formatTime formats a time for the sync state table, or - when unset
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.In(timeZone).Format(time.RFC3339)
+}
+
+func runSources(args []string) int {
+	fs := flag.NewFlagSet("sources", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the sync state as JSON instead of a table")
+	fs.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	cur, err := c.Database(karaokeDB).Collection(syncStateCollection).Find(
+		ctx,
+		bson.D{},
+		options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		fmt.Printf("Error retrieving sync state: %v", err)
+		panic(err)
+	}
+
+	sts := []syncState{}
+	if err = cur.All(ctx, &sts); err != nil {
+		fmt.Printf("Error reading sync state: %v", err)
+		panic(err)
+	}
+
+	if *asJSON {
+		b, err := json.Marshal(sts)
+		if err != nil {
+			fmt.Printf("Error encoding sync state: %v", err)
+			panic(err)
+		}
+
+		fmt.Println(string(b))
+		return exitOK
+	}
+
+	for _, st := range sts {
+		fmt.Printf("%s\n", st.Source)
+		fmt.Printf("  last sync:         %s %s\n", formatTime(st.LastSyncAt), st.LastError)
+		fmt.Printf("  last success:      %s\n", formatTime(st.LastSuccessAt))
+		fmt.Printf("  latest date added: %s\n", formatTime(st.LatestDateAdded))
+		fmt.Printf("  songs:             %d\n", st.Songs)
+		if st.ETag != "" || st.LastModified != "" {
+			fmt.Printf("  validators:        %s %s\n", st.ETag, st.LastModified)
+		}
+	}
+
+	return exitOK
+}
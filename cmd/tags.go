@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// taggedSong is the subset of a song document needed to manage tags
+type taggedSong struct {
+	ID     SongID   `bson:"id"`
+	Title  string   `bson:"title"`
+	Artist string   `bson:"artist"`
+	Tags   []string `bson:"tags"`
+}
+
+// splitList splits a comma separated list, dropping empty values
+func splitList(s string) []string {
+	var vals []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			vals = append(vals, v)
+		}
+	}
+
+	return vals
+}
+
+// songsFilter builds a query from a comma separated list of IDs, a MongoDB
+// filter in extended JSON, and/or a query (see parseQuery)
+func songsFilter(ids string, filter string, q string) (bson.M, error) {
+	var cnds bson.A
+
+	if ids != "" {
+		var sids []SongID
+		for _, v := range splitList(ids) {
+			id, err := parseSongID(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid song id: %s", v)
+			}
+
+			sids = append(sids, id)
+		}
+
+		cnds = append(cnds, bson.M{"id": bson.M{"$in": sids}})
+	}
+
+	if filter != "" {
+		var f bson.M
+		if err := bson.UnmarshalExtJSON([]byte(filter), false, &f); err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+
+		cnds = append(cnds, f)
+	}
+
+	if q != "" {
+		f, err := parseQuery(q)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query: %w", err)
+		}
+
+		cnds = append(cnds, f)
+	}
+
+	switch len(cnds) {
+	case 0:
+		return nil, fmt.Errorf("either ids, a filter, or a query is required")
+	case 1:
+		return cnds[0].(bson.M), nil
+	default:
+		return bson.M{"$and": cnds}, nil
+	}
+}
+
+// tagChanges returns the tags that would be added to and removed from a song
+func tagChanges(sng taggedSong, add []string, rm []string) ([]string, []string) {
+	has := make(map[string]bool, len(sng.Tags))
+	for _, t := range sng.Tags {
+		has[t] = true
+	}
+
+	var added, removed []string
+	for _, t := range add {
+		if !has[t] {
+			added = append(added, t)
+		}
+	}
+
+	for _, t := range rm {
+		if has[t] {
+			removed = append(removed, t)
+		}
+	}
+
+	return added, removed
+}
+
+// sharedTags returns the tags that are both added and removed, whose outcome
+// would depend on the order the updates run in
+func sharedTags(add []string, rm []string) []string {
+	adding := make(map[string]bool, len(add))
+	for _, t := range add {
+		adding[t] = true
+	}
+
+	var shr []string
+	for _, t := range rm {
+		if adding[t] {
+			shr = append(shr, t)
+			delete(adding, t)
+		}
+	}
+
+	return shr
+}
+
+// listTags prints every tag in use with the number of songs it is applied to
+func listTags(ctx context.Context, c *mongo.Client) {
+	cur, err := c.Database(karaokeDB).Collection(songsCollection).Aggregate(ctx, mongo.Pipeline{
+		bson.D{primitive.E{
+			Key:   "$unwind",
+			Value: "$tags",
+		}},
+		bson.D{primitive.E{
+			Key: "$group",
+			Value: bson.M{
+				"_id":   "$tags",
+				"songs": bson.M{"$sum": 1},
+			},
+		}},
+		bson.D{primitive.E{
+			Key:   "$sort",
+			Value: bson.D{primitive.E{Key: "songs", Value: -1}, primitive.E{Key: "_id", Value: 1}},
+		}},
+	})
+	if err != nil {
+		fmt.Printf("Error listing tags: %v", err)
+		panic(err)
+	}
+
+	var tgs []struct {
+		Tag   string `bson:"_id"`
+		Songs int    `bson:"songs"`
+	}
+	if err = cur.All(ctx, &tgs); err != nil {
+		fmt.Printf("Error reading tags: %v", err)
+		panic(err)
+	}
+
+	for _, tg := range tgs {
+		fmt.Printf("%s\t%d songs\n", tg.Tag, tg.Songs)
+	}
+}
+
+// renameTag renames a tag on every song, keeping a single copy on songs that
+// already have the new tag
+func renameTag(ctx context.Context, c *mongo.Client, from string, to string) {
+	clctn := c.Database(karaokeDB).Collection(songsCollection)
+
+	if _, err := clctn.UpdateMany(ctx, bson.M{"tags": from}, bson.M{"$addToSet": bson.M{"tags": to}}); err != nil {
+		fmt.Printf("Error renaming tag (%s): %v", from, err)
+		panic(err)
+	}
+
+	res, err := clctn.UpdateMany(ctx, bson.M{"tags": from}, bson.M{"$pull": bson.M{"tags": from}})
+	if err != nil {
+		fmt.Printf("Error renaming tag (%s): %v", from, err)
+		panic(err)
+	}
+
+	fmt.Printf("Renamed tag \"%s\" to \"%s\" on %d songs\n", from, to, res.ModifiedCount)
+}
+
+// deleteTag removes a tag from every song
+func deleteTag(ctx context.Context, c *mongo.Client, tag string) {
+	res, err := c.Database(karaokeDB).Collection(songsCollection).UpdateMany(ctx, bson.M{"tags": tag}, bson.M{"$pull": bson.M{"tags": tag}})
+	if err != nil {
+		fmt.Printf("Error removing tag (%s): %v", tag, err)
+		panic(err)
+	}
+
+	fmt.Printf("Removed tag \"%s\" from %d songs\n", tag, res.ModifiedCount)
+}
+
+func runTags(args []string) int {
+	fs := flag.NewFlagSet("tags", flag.ExitOnError)
+	ids := fs.String("ids", "", "comma separated song `ids` to update")
+	filter := fs.String("filter", "", "MongoDB query `filter` (extended JSON) selecting songs to update")
+	q := fs.String("q", "", "`query` selecting songs to update, e.g. artist:\"queen\" year:1975..1985 -explicit")
+	add := fs.String("add", "", "comma separated `tags` to add")
+	rm := fs.String("remove", "", "comma separated `tags` to remove")
+	preview := fs.Bool("preview", false, "print the changes that would be made without applying them")
+	list := fs.Bool("list", false, "list all tags with song counts, or the tags of the selected songs")
+	rename := fs.String("rename", "", "rename a tag on every song (`old=new`)")
+	del := fs.String("delete", "", "remove a `tag` from every song")
+	fs.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	// listing only reads, so it does not make changes asked for with it
+	if *list && (*add != "" || *rm != "" || *rename != "" || *del != "") {
+		fmt.Println("Error: -list can not be used with -add, -remove, -rename, or -delete")
+		fs.Usage()
+		return exitConfig
+	}
+
+	// catalog wide operations do not need a selection
+	if *list && *ids == "" && *filter == "" && *q == "" {
+		c := connectMongo(ctx)
+		defer disconnectMongo(c)
+
+		listTags(ctx, c)
+		return exitOK
+	}
+
+	if *rename != "" && *del != "" {
+		fmt.Println("Error: -rename and -delete can not be used together")
+		fs.Usage()
+		return exitConfig
+	}
+
+	if *rename != "" {
+		// removing a tag has to be asked for with -delete
+		from, to, ok := strings.Cut(*rename, "=")
+		if from, to = strings.TrimSpace(from), strings.TrimSpace(to); !ok || from == "" || to == "" {
+			fmt.Printf("Error: rename must be in the form old=new (use -delete to remove a tag): %s\n", *rename)
+			fs.Usage()
+			return exitConfig
+		}
+
+		if from == to {
+			fmt.Printf("Error: rename must change the tag: %s\n", *rename)
+			fs.Usage()
+			return exitConfig
+		}
+
+		c := connectMongo(ctx)
+		defer disconnectMongo(c)
+
+		renameTag(ctx, c, from, to)
+		return exitOK
+	}
+
+	if *del != "" {
+		tag := strings.TrimSpace(*del)
+		if tag == "" {
+			fmt.Println("Error: -delete requires a tag")
+			fs.Usage()
+			return exitConfig
+		}
+
+		c := connectMongo(ctx)
+		defer disconnectMongo(c)
+
+		deleteTag(ctx, c, tag)
+		return exitOK
+	}
+
+	qry, err := songsFilter(*ids, *filter, *q)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fs.Usage()
+		return exitConfig
+	}
+
+	atgs, rtgs := splitList(*add), splitList(*rm)
+	if !*list && len(atgs) == 0 && len(rtgs) == 0 {
+		fmt.Println("Error: at least one tag to add or remove is required")
+		fs.Usage()
+		return exitConfig
+	}
+
+	if shr := sharedTags(atgs, rtgs); len(shr) > 0 {
+		fmt.Printf("Error: tags can not be both added and removed: %s\n", strings.Join(shr, ","))
+		fs.Usage()
+		return exitConfig
+	}
+
+	c := connectMongo(ctx)
+	defer disconnectMongo(c)
+
+	clctn := c.Database(karaokeDB).Collection(songsCollection)
+
+	// show the tags of each matching song or what would change for it
+	if *list || *preview {
+		cur, err := clctn.Find(
+			ctx,
+			qry,
+			options.Find().
+				SetProjection(bson.M{"_id": 0, "id": 1, "title": 1, "artist": 1, "tags": 1}).
+				SetSort(bson.M{"id": 1}))
+		if err != nil {
+			fmt.Printf("Error retrieving songs: %v", err)
+			panic(err)
+		}
+
+		var sngs []taggedSong
+		if err = cur.All(ctx, &sngs); err != nil {
+			fmt.Printf("Error reading songs: %v", err)
+			panic(err)
+		}
+
+		if *list {
+			for _, sng := range sngs {
+				fmt.Printf("Song (%s): \"%s\" by %s: [%s]\n", sng.ID, sng.Title, sng.Artist, strings.Join(sng.Tags, ","))
+			}
+
+			return exitOK
+		}
+
+		m := 0
+		for _, sng := range sngs {
+			added, removed := tagChanges(sng, atgs, rtgs)
+			if len(added) == 0 && len(removed) == 0 {
+				continue
+			}
+
+			m++
+			fmt.Printf("Song (%s): \"%s\" by %s: +[%s] -[%s]\n", sng.ID, sng.Title, sng.Artist, strings.Join(added, ","), strings.Join(removed, ","))
+		}
+
+		fmt.Printf("Preview: %d songs matched and %d songs would be modified\n", len(sngs), m)
+		return exitOK
+	}
+
+	// the same field can not be added to and pulled from in one update
+	var res *mongo.UpdateResult
+	m := int64(0)
+	if len(atgs) > 0 {
+		if res, err = clctn.UpdateMany(ctx, qry, bson.M{"$addToSet": bson.M{"tags": bson.M{"$each": atgs}}}); err != nil {
+			fmt.Printf("Error adding tags: %v", err)
+			panic(err)
+		}
+
+		m += res.ModifiedCount
+	}
+
+	if len(rtgs) > 0 {
+		if res, err = clctn.UpdateMany(ctx, qry, bson.M{"$pull": bson.M{"tags": bson.M{"$in": rtgs}}}); err != nil {
+			fmt.Printf("Error removing tags: %v", err)
+			panic(err)
+		}
+
+		m += res.ModifiedCount
+	}
+
+	fmt.Printf("Tags updated: %d songs matched and %d modifications made\n", res.MatchedCount, m)
+
+	return exitOK
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSplitList(t *testing.T) {
+	for in, want := range map[string][]string{
+		"":                        nil,
+		" , ,":                    nil,
+		"Holiday":                 {"Holiday"},
+		" crowd pleaser ,avoid,,": {"crowd pleaser", "avoid"},
+	} {
+		if got := splitList(in); !reflect.DeepEqual(got, want) {
+			t.Errorf("splitList(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTagChanges(t *testing.T) {
+	sng := taggedSong{ID: "6534", Tags: []string{"Holiday", "avoid"}}
+
+	added, removed := tagChanges(sng, []string{"Holiday", "crowd pleaser"}, []string{"avoid", "ballad"})
+	if !reflect.DeepEqual(added, []string{"crowd pleaser"}) || !reflect.DeepEqual(removed, []string{"avoid"}) {
+		t.Errorf("tagChanges = +%q -%q, want +[crowd pleaser] -[avoid]", added, removed)
+	}
+
+	if added, removed := tagChanges(taggedSong{ID: "1"}, nil, []string{"avoid"}); added != nil || removed != nil {
+		t.Errorf("tagChanges of an untagged song = +%q -%q, want no changes", added, removed)
+	}
+}
+
+func TestSharedTags(t *testing.T) {
+	for _, tc := range []struct {
+		add, rm, want []string
+	}{
+		{add: []string{"Holiday"}, rm: []string{"avoid"}},
+		{add: []string{"Holiday", "avoid"}, rm: []string{"avoid", "avoid", "ballad"}, want: []string{"avoid"}},
+		{add: nil, rm: []string{"avoid"}},
+	} {
+		if got := sharedTags(tc.add, tc.rm); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("sharedTags(%q, %q) = %q, want %q", tc.add, tc.rm, got, tc.want)
+		}
+	}
+}
+
+func TestSongsFilter(t *testing.T) {
+	got, err := songsFilter("6534, 49375", `{"styles": "Christmas"}`, "duo")
+	if err != nil {
+		t.Fatalf("songsFilter: %v", err)
+	}
+
+	want := bson.M{"$and": bson.A{
+		bson.M{"id": bson.M{"$in": []SongID{"6534", "49375"}}},
+		bson.M{"styles": "Christmas"},
+		bson.M{"duo": true},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("songsFilter = %v, want %v", got, want)
+	}
+
+	for _, tc := range []struct{ ids, filter, q string }{
+		{},
+		{filter: "{styles"},
+		{q: "venue:apollo"},
+	} {
+		if _, err := songsFilter(tc.ids, tc.filter, tc.q); err == nil {
+			t.Errorf("songsFilter(%q, %q, %q) accepted", tc.ids, tc.filter, tc.q)
+		}
+	}
+}
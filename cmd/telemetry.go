@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const telemetryVersion = 1
+
+var (
+	telemetryEndpoint string
+	telemetryTimeout  = providerTimeout("TELEMETRY", 5*time.Second)
+)
+
+// telemetryPayload is the anonymous, aggregate usage report; it never
+// includes catalog contents, flag values, paths, or host information
+type telemetryPayload struct {
+	Version     int      `json:"version"`
+	Command     string   `json:"command"`
+	CatalogSize int64    `json:"catalogSize"`
+	Features    []string `json:"features"`
+	OS          string   `json:"os"`
+	Arch        string   `json:"arch"`
+}
+
+// sendTelemetry reports usage to the configured endpoint when the operator
+// has opted in; failures are printed and otherwise ignored
+func sendTelemetry(ctx context.Context, c *mongo.Client, fs *flag.FlagSet) {
+	if telemetryEndpoint == "" {
+		return
+	}
+
+	n, err := c.Database(karaokeDB).Collection(songsCollection).EstimatedDocumentCount(ctx)
+	if err != nil {
+		fmt.Printf("Error counting songs for telemetry: %v\n", err)
+		return
+	}
+
+	// report which flags were used, but never their values
+	ftrs := []string{}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "telemetry-endpoint" {
+			ftrs = append(ftrs, f.Name)
+		}
+	})
+	sort.Strings(ftrs)
+
+	b, err := json.Marshal(telemetryPayload{
+		Version:     telemetryVersion,
+		Command:     fs.Name(),
+		CatalogSize: n,
+		Features:    ftrs,
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+	})
+	if err != nil {
+		fmt.Printf("Error encoding telemetry: %v\n", err)
+		return
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, telemetryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(tctx, http.MethodPost, telemetryEndpoint, bytes.NewReader(b))
+	if err != nil {
+		fmt.Printf("Error creating telemetry request (%s): %v\n", telemetryEndpoint, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		fmt.Printf("Error sending telemetry (%s): %v\n", telemetryEndpoint, err)
+		return
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		fmt.Printf("Error sending telemetry (%s): %s\n", telemetryEndpoint, res.Status)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	//go:embed notify.tmpl
+	notifyTemplateText string
+	// notifyTemplatePath names a file of templates replacing the defaults
+	notifyTemplatePath = os.Getenv("KARAOKE_NOTIFY_TEMPLATE")
+	notifyTemplates    *template.Template
+)
+
+// templateFuncs are the helpers available to notification templates, named
+// after their sprig equivalents
+var templateFuncs = template.FuncMap{
+	"date": func(layout string, t time.Time) string {
+		return t.In(timeZone).Format(layout)
+	},
+	"default": func(def any, v any) any {
+		if v == nil || fmt.Sprint(v) == "" || fmt.Sprint(v) == "0" {
+			return def
+		}
+
+		return v
+	},
+	"join": func(sep string, v any) string {
+		switch vs := v.(type) {
+		case []string:
+			return strings.Join(vs, sep)
+		case []Style:
+			return joinValues(vs, sep)
+		case []Language:
+			return joinValues(vs, sep)
+		default:
+			return fmt.Sprint(v)
+		}
+	},
+	"lower": strings.ToLower,
+	"plural": func(one string, many string, n int) string {
+		if n == 1 {
+			return one
+		}
+
+		return many
+	},
+	"min": func(a int, b int) int {
+		if a < b {
+			return a
+		}
+
+		return b
+	},
+	"sub": func(a int, b int) int {
+		return a - b
+	},
+	"title": func(s string) string {
+		if s == "" {
+			return s
+		}
+
+		r, n := utf8.DecodeRuneInString(s)
+		return string(unicode.ToUpper(r)) + s[n:]
+	},
+	"trim": strings.TrimSpace,
+	"trunc": func(n int, s string) string {
+		if utf8.RuneCountInString(s) <= n {
+			return s
+		}
+
+		return string([]rune(s)[:n]) + "…"
+	},
+	"upper": strings.ToUpper,
+}
+
+// loadNotifyTemplates parses the default notification templates and then
+// the templates file, when there is one, so it only needs to define the
+// messages it changes
+func loadNotifyTemplates() error {
+	tmpl, err := template.New("notify").Funcs(templateFuncs).Parse(notifyTemplateText)
+	if err != nil {
+		return err
+	}
+
+	if notifyTemplatePath != "" {
+		b, err := os.ReadFile(notifyTemplatePath)
+		if err != nil {
+			return err
+		}
+
+		if tmpl, err = tmpl.Parse(string(b)); err != nil {
+			return err
+		}
+	}
+
+	notifyTemplates = tmpl
+	return nil
+}
+
+// renderNotification executes the named notification template
+func renderNotification(name string, data any) (string, error) {
+	if notifyTemplates == nil {
+		if err := loadNotifyTemplates(); err != nil {
+			return "", err
+		}
+	}
+
+	var s strings.Builder
+	if err := notifyTemplates.ExecuteTemplate(&s, name, data); err != nil {
+		return "", err
+	}
+
+	return s.String(), nil
+}
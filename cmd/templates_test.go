@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTemplateTitle(t *testing.T) {
+	title := templateFuncs["title"].(func(string) string)
+	for in, want := range map[string]string{"": "", "pop": "Pop", "été": "Été", "R&B": "R&B"} {
+		if got := title(in); got != want {
+			t.Errorf("title(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSongsAddedCapped(t *testing.T) {
+	notifyTemplates = nil
+	t.Cleanup(func() { notifyTemplates = nil })
+
+	// songs returns n songs of each style
+	songs := func(n int, styles ...string) []Song {
+		var sngs []Song
+		for _, st := range styles {
+			for i := 0; i < n; i++ {
+				sngs = append(sngs, Song{ID: SongID(fmt.Sprint(len(sngs) + 1)), Title: fmt.Sprintf("Song %d", i+1), Artist: "Anon", Styles: []Style{Style(st)}})
+			}
+		}
+
+		return sngs
+	}
+
+	for _, tc := range []struct {
+		name string
+		sngs []Song
+		want string
+	}{
+		{
+			name: "one song",
+			sngs: songs(1, "Pop"),
+			want: "1 new song just landed in the catalog!\n\n*Pop*\n• \"Song 1\" by Anon\n",
+		},
+		{
+			name: "short",
+			sngs: songs(2, "Pop"),
+			want: "2 new songs just landed in the catalog!\n\n*Pop*\n• \"Song 1\" by Anon\n• \"Song 2\" by Anon\n",
+		},
+		{
+			name: "songs capped",
+			sngs: songs(8, "Pop"),
+			want: "8 new songs just landed in the catalog!\n\n*Pop*\n• \"Song 1\" by Anon\n• \"Song 2\" by Anon\n• \"Song 3\" by Anon\n• \"Song 4\" by Anon\n• \"Song 5\" by Anon\n…and 3 more\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := renderNotification("songs.added", newSongsAnnouncement(tc.sngs))
+			if err != nil {
+				t.Fatalf("renderNotification: %v", err)
+			}
+
+			if got != tc.want {
+				t.Errorf("songs.added = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	// a first import into an empty catalog stays a short message
+	var styles []string
+	for i := 0; i < 40; i++ {
+		styles = append(styles, fmt.Sprintf("Style %02d", i+1))
+	}
+
+	pld := newSongsAnnouncement(songs(1000, styles...))
+	got, err := renderNotification("songs.added", pld)
+	if err != nil {
+		t.Fatalf("renderNotification: %v", err)
+	}
+
+	if lns := strings.Count(got, "\n"); lns > 100 || !strings.HasSuffix(got, "…and 30 more styles\n") {
+		t.Errorf("songs.added for 40000 songs has %d lines:\n%s", lns, got)
+	}
+
+	// and so does the webhook payload
+	b, err := json.Marshal(pld)
+	if err != nil {
+		t.Fatalf("encoding payload: %v", err)
+	}
+
+	if len(b) > 32<<10 {
+		t.Errorf("payload for 40000 songs is %d bytes", len(b))
+	}
+
+	if len(pld.Styles) != announceGroups || pld.MoreStyles != 30 || pld.Styles[0].Count != 1000 || len(pld.Styles[0].Songs) != announceSongs {
+		t.Errorf("payload styles = %d listed of %d, the first with %d of %d songs", len(pld.Styles), len(pld.Styles)+pld.MoreStyles, len(pld.Styles[0].Songs), pld.Styles[0].Count)
+	}
+
+	if len(pld.Artists) != 1 || pld.MoreArtists != 0 || pld.Artists[0].Count != 40000 || len(pld.Artists[0].Songs) != announceSongs {
+		t.Errorf("payload artists = %+v", pld.Artists)
+	}
+}
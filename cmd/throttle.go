@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// slowBatchFactor is how many times slower than the fastest batch a
+	// write must be before it is treated as a sign of cluster pressure
+	slowBatchFactor = 4
+	writeAttempts   = 5
+)
+
+var (
+	maxOpsPerSec float64
+	// pressureCodes are server errors that indicate an overloaded or
+	// failing over cluster rather than a bad write
+	pressureCodes = []int{
+		50,    // MaxTimeMSExpired
+		91,    // ShutdownInProgress
+		112,   // WriteConflict
+		189,   // PrimarySteppedDown
+		262,   // ExceededTimeLimit
+		10107, // NotWritablePrimary
+		11600, // InterruptedAtShutdown
+		13435, // NotPrimaryNoSecondaryOk
+	}
+)
+
+// throttle paces bulk writes to a maximum number of operations per second
+// and backs off further while the cluster shows signs of pressure
+type throttle struct {
+	ceiling float64
+	fastest time.Duration // fastest latency per operation
+	max     float64
+	next    time.Time
+	rate    float64
+}
+
+func newThrottle(max float64) *throttle {
+	return &throttle{ceiling: max, max: max, rate: max}
+}
+
+func (t *throttle) String() string {
+	if t.rate == 0 {
+		return "unlimited ops/sec"
+	}
+
+	return fmt.Sprintf("%.0f ops/sec", t.rate)
+}
+
+// underPressure reports whether a write failed because the cluster is
+// overloaded, timing out, or failing over, so it is worth retrying slower
+func underPressure(err error) bool {
+	if mongo.IsTimeout(err) || mongo.IsNetworkError(err) {
+		return true
+	}
+
+	var se mongo.ServerError
+	if !errors.As(err, &se) {
+		return false
+	}
+
+	if se.HasErrorLabel("RetryableWriteError") || se.HasErrorLabel("TransientTransactionError") {
+		return true
+	}
+
+	for _, c := range pressureCodes {
+		if se.HasErrorCode(c) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sleep waits for the duration unless the context is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	tmr := time.NewTimer(d)
+	defer tmr.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-tmr.C:
+		return nil
+	}
+}
+
+// wait blocks until n more operations fit within the current rate
+func (t *throttle) wait(ctx context.Context, n int) error {
+	if t.rate == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if t.next.After(now) {
+		if err := sleep(ctx, t.next.Sub(now)); err != nil {
+			return err
+		}
+
+		now = t.next
+	}
+
+	t.next = now.Add(time.Duration(float64(n) / t.rate * float64(time.Second)))
+	return nil
+}
+
+// slowDown halves the rate, starting from the observed rate when writes
+// were unlimited, and never recovers past twice that observed rate
+func (t *throttle) slowDown(n int, lat time.Duration) {
+	if t.rate == 0 {
+		t.rate = float64(n) / lat.Seconds()
+		if t.max == 0 {
+			t.ceiling = t.rate * 2
+		}
+	}
+
+	t.rate /= 2
+	if t.rate < 1 {
+		t.rate = 1
+	}
+}
+
+// observe adjusts the rate after a successful batch: slow batches count as
+// pressure, fast batches recover the rate towards its ceiling
+func (t *throttle) observe(n int, lat time.Duration) {
+	// compare the latency per operation so short batches are comparable
+	per := lat / time.Duration(n)
+	if t.fastest == 0 || per < t.fastest {
+		t.fastest = per
+	}
+
+	if per > t.fastest*slowBatchFactor {
+		t.slowDown(n, lat)
+		fmt.Printf("Slow write (%s), throttling import to %s\n", lat.Round(time.Millisecond), t)
+		return
+	}
+
+	if t.rate == 0 || t.rate == t.ceiling {
+		return
+	}
+
+	t.rate *= 1.25
+	if t.rate >= t.ceiling {
+		t.rate = t.ceiling
+
+		// unlimited imports return to full speed once recovered
+		if t.max == 0 {
+			t.rate = 0
+		}
+	}
+}
+
+// write runs a bulk write at the throttled rate, retrying with exponential
+// backoff while the cluster is under pressure
+func (t *throttle) write(ctx context.Context, clctn *mongo.Collection, wms []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	for att := 1; ; att++ {
+		if err := t.wait(ctx, len(wms)); err != nil {
+			return nil, err
+		}
+
+		wctx, cancel := context.WithTimeout(ctx, mongoTimeout)
+		st := time.Now()
+		res, err := clctn.BulkWrite(wctx, wms)
+		lat := time.Since(st)
+		cancel()
+
+		if err == nil {
+			t.observe(len(wms), lat)
+			return res, nil
+		}
+
+		if ctx.Err() != nil || att == writeAttempts || !underPressure(err) {
+			return res, err
+		}
+
+		// upserts are idempotent, so the whole batch can be retried
+		t.slowDown(len(wms), lat)
+		d := time.Duration(1<<(att-1)) * time.Second
+		fmt.Printf("Cluster under pressure (%v), retrying in %s at %s\n", err, d, t)
+
+		if err := sleep(ctx, d); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestUnderPressure(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"timeout", context.DeadlineExceeded, true},
+		{"stepped down", mongo.CommandError{Code: 189, Name: "PrimarySteppedDown"}, true},
+		{"wrapped write conflict", fmt.Errorf("writing: %w", mongo.CommandError{Code: 112}), true},
+		{"transient label", mongo.CommandError{Code: 1, Labels: []string{"TransientTransactionError"}}, true},
+		{"duplicate key", mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}, false},
+		{"validation", mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 121}}}, false},
+		{"other", errors.New("bad request"), false},
+	} {
+		if got := underPressure(tc.err); got != tc.want {
+			t.Errorf("%s: underPressure = %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestThrottleLimited(t *testing.T) {
+	th := newThrottle(100)
+
+	// pressure halves the rate, down to one op/sec
+	th.slowDown(100, time.Second)
+	if th.rate != 50 {
+		t.Fatalf("rate after slowing down = %v, want 50", th.rate)
+	}
+
+	for i := 0; i < 10; i++ {
+		th.slowDown(100, time.Second)
+	}
+	if th.rate != 1 {
+		t.Fatalf("rate after slowing down repeatedly = %v, want 1", th.rate)
+	}
+
+	// fast batches recover the rate to the maximum and no further
+	for i := 0; i < 50; i++ {
+		th.observe(100, 10*time.Millisecond)
+	}
+	if th.rate != 100 {
+		t.Errorf("recovered rate = %v, want 100", th.rate)
+	}
+
+	// a batch much slower per operation than the fastest counts as pressure
+	th.observe(10, time.Second)
+	if th.rate != 50 {
+		t.Errorf("rate after a slow batch = %v, want 50", th.rate)
+	}
+}
+
+func TestThrottleUnlimited(t *testing.T) {
+	th := newThrottle(0)
+	if th.String() != "unlimited ops/sec" {
+		t.Errorf("String = %s, want unlimited ops/sec", th)
+	}
+
+	// slowing down starts from the observed rate
+	th.observe(1000, time.Second)
+	th.slowDown(1000, time.Second)
+	if th.rate != 500 || th.ceiling != 2000 {
+		t.Fatalf("rate, ceiling = %v, %v, want 500, 2000", th.rate, th.ceiling)
+	}
+
+	// and returns to unlimited once recovered
+	for i := 0; i < 50 && th.rate != 0; i++ {
+		th.observe(1000, time.Second)
+	}
+	if th.rate != 0 {
+		t.Errorf("recovered rate = %v, want unlimited", th.rate)
+	}
+}
+
+func TestThrottleWait(t *testing.T) {
+	th := newThrottle(100)
+
+	st := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := th.wait(context.Background(), 5); err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+	}
+
+	// the first batch is immediate, the next two wait 50ms each
+	if d := time.Since(st); d < 100*time.Millisecond {
+		t.Errorf("3 batches of 5 at 100 ops/sec took %s, want at least 100ms", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	th.next = time.Now().Add(time.Hour)
+	if err := th.wait(ctx, 5); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait when canceled = %v, want %v", err, context.Canceled)
+	}
+}
@@ -2,7 +2,10 @@ module github.com/brozeph/karaoke-fun
 
 go 1.20
 
-require go.mongodb.org/mongo-driver v1.12.1
+require (
+	go.mongodb.org/mongo-driver v1.12.1
+	golang.org/x/text v0.12.0
+)
 
 require (
 	github.com/golang/snappy v0.0.4 // indirect
@@ -14,5 +17,4 @@ require (
 	github.com/youmark/pkcs8 v0.0.0-20201027041543-1326539a0a0a // indirect
 	golang.org/x/crypto v0.11.0 // indirect
 	golang.org/x/sync v0.3.0 // indirect
-	golang.org/x/text v0.12.0 // indirect
 )
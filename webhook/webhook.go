@@ -0,0 +1,121 @@
+// Package webhook signs the webhook deliveries sent by karaoke-fun and
+// verifies them on the receiving side.
+//
+// Each delivery carries a SignatureHeader of the form
+//
+//	t=1700000000,v1=5257a869e7ecebeda32affa62cdca3fa51cad7e77a0e56ff536d0ce8e108d8bd
+//
+// where t is the Unix time the delivery was signed and v1 is the hex encoded
+// HMAC-SHA256 of the timestamp, a period, and the request body, keyed with
+// the endpoint's secret. Receivers reject deliveries signed outside of a
+// tolerance window so captured requests can not be replayed later.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTolerance is the replay window used when verifying with a zero
+// tolerance
+const DefaultTolerance = 5 * time.Minute
+
+// SignatureHeader is the request header holding the delivery signature
+const SignatureHeader = "X-Karaoke-Signature"
+
+var (
+	// ErrInvalidHeader is returned when the signature header is missing or
+	// malformed
+	ErrInvalidHeader = errors.New("webhook: invalid signature header")
+	// ErrNoMatch is returned when no signature matches the secret
+	ErrNoMatch = errors.New("webhook: signature does not match")
+	// ErrExpired is returned when the delivery was signed outside of the
+	// tolerance window
+	ErrExpired = errors.New("webhook: signature timestamp outside of tolerance")
+)
+
+// signature computes the v1 signature of a body signed at a time
+func signature(secret []byte, ts int64, body []byte) []byte {
+	m := hmac.New(sha256.New, secret)
+	fmt.Fprintf(m, "%d.", ts)
+	m.Write(body)
+	return m.Sum(nil)
+}
+
+// Sign returns the SignatureHeader value for a body signed at a time
+func Sign(secret []byte, ts time.Time, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", ts.Unix(), hex.EncodeToString(signature(secret, ts.Unix(), body)))
+}
+
+// Verify checks that a SignatureHeader value was produced for the body with
+// the secret no more than the tolerance before or after now; any of several
+// v1 signatures may match, which allows secrets to be rotated
+func Verify(secret []byte, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+
+	var ts int64
+	var sigs [][]byte
+	for _, p := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if !ok {
+			return ErrInvalidHeader
+		}
+
+		switch k {
+		case "t":
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return ErrInvalidHeader
+			}
+			ts = n
+		case "v1":
+			sig, err := hex.DecodeString(v)
+			if err != nil {
+				return ErrInvalidHeader
+			}
+			sigs = append(sigs, sig)
+		}
+	}
+
+	if ts == 0 || len(sigs) == 0 {
+		return ErrInvalidHeader
+	}
+
+	if d := now.Sub(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+		return ErrExpired
+	}
+
+	want := signature(secret, ts, body)
+	for _, sig := range sigs {
+		if hmac.Equal(sig, want) {
+			return nil
+		}
+	}
+
+	return ErrNoMatch
+}
+
+// VerifyRequest reads the body of a delivery and verifies its signature,
+// returning the body when it is valid
+func VerifyRequest(r *http.Request, secret []byte, tolerance time.Duration) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Verify(secret, r.Header.Get(SignatureHeader), body, tolerance, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("whsec_test")
+	body := []byte(`{"event":"songs.added","count":3}`)
+	signed := time.Unix(1700000000, 0)
+	hdr := Sign(secret, signed, body)
+
+	for _, tc := range []struct {
+		name      string
+		secret    []byte
+		header    string
+		body      []byte
+		tolerance time.Duration
+		now       time.Time
+		err       error
+	}{
+		{name: "valid", secret: secret, header: hdr, body: body, now: signed},
+		{name: "valid within tolerance", secret: secret, header: hdr, body: body, now: signed.Add(DefaultTolerance - time.Second)},
+		{name: "valid before signing within tolerance", secret: secret, header: hdr, body: body, now: signed.Add(-time.Minute)},
+		{name: "rotated secret", secret: secret, header: hdr + ",v1=" + strings.Repeat("00", 32), body: body, now: signed},
+		{name: "tampered body", secret: secret, header: hdr, body: []byte(`{"event":"songs.added","count":4}`), now: signed, err: ErrNoMatch},
+		{name: "wrong secret", secret: []byte("whsec_other"), header: hdr, body: body, now: signed, err: ErrNoMatch},
+		{name: "stale", secret: secret, header: hdr, body: body, now: signed.Add(DefaultTolerance + time.Second), err: ErrExpired},
+		{name: "future", secret: secret, header: hdr, body: body, now: signed.Add(-DefaultTolerance - time.Second), err: ErrExpired},
+		{name: "custom tolerance", secret: secret, header: hdr, body: body, tolerance: time.Second, now: signed.Add(2 * time.Second), err: ErrExpired},
+		{name: "missing timestamp", secret: secret, header: hdr[strings.Index(hdr, ",")+1:], body: body, now: signed, err: ErrInvalidHeader},
+		{name: "missing signature", secret: secret, header: "t=1700000000", body: body, now: signed, err: ErrInvalidHeader},
+		{name: "empty header", secret: secret, header: "", body: body, now: signed, err: ErrInvalidHeader},
+		{name: "malformed pair", secret: secret, header: "t=1700000000,v1", body: body, now: signed, err: ErrInvalidHeader},
+		{name: "malformed timestamp", secret: secret, header: strings.Replace(hdr, "t=1700000000", "t=soon", 1), body: body, now: signed, err: ErrInvalidHeader},
+		{name: "malformed signature", secret: secret, header: "t=1700000000,v1=not-hex", body: body, now: signed, err: ErrInvalidHeader},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := Verify(tc.secret, tc.header, tc.body, tc.tolerance, tc.now); !errors.Is(err, tc.err) {
+				t.Errorf("Verify(%q) = %v, want %v", tc.header, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	body := []byte("{}")
+	ts := time.Unix(1700000000, 0)
+
+	hdr := Sign([]byte("whsec_test"), ts, body)
+	if !strings.HasPrefix(hdr, "t=1700000000,v1=") || len(hdr) != len("t=1700000000,v1=")+64 {
+		t.Errorf("Sign = %q, want t=1700000000,v1= and a hex encoded HMAC-SHA256", hdr)
+	}
+
+	if Sign([]byte("whsec_test"), ts.Add(time.Second), body) == hdr {
+		t.Errorf("Sign does not cover the timestamp")
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	secret := []byte("whsec_test")
+	body := []byte(`{"event":"songs.added"}`)
+
+	req := httptest.NewRequest(http.MethodPost, "/hooks/karaoke", bytes.NewReader(body))
+	req.Header.Set(SignatureHeader, Sign(secret, time.Now(), body))
+
+	b, err := VerifyRequest(req, secret, 0)
+	if err != nil {
+		t.Fatalf("VerifyRequest: %v", err)
+	}
+
+	if !bytes.Equal(b, body) {
+		t.Errorf("VerifyRequest body = %q, want %q", b, body)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/hooks/karaoke", bytes.NewReader(body))
+	if _, err := VerifyRequest(req, secret, 0); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("VerifyRequest without a signature = %v, want %v", err, ErrInvalidHeader)
+	}
+}